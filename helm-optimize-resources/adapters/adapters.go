@@ -0,0 +1,75 @@
+package adapters
+
+import (
+	"errors"
+	"sync"
+)
+
+//InsightProvider is implemented by every parameter repository the plugin can pull insights from.
+type InsightProvider interface {
+
+	//Name is the display name of the adapter.  It is also the value persisted in the plugin secret.
+	Name() string
+
+	//Initialize readies the adapter to serve insights, prompting for any missing configuration.
+	Initialize() error
+
+	//GetInsight returns the resource spec and approval setting for a container.
+	GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error)
+
+	//GetApprovalSetting returns the approval setting for a container.
+	GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error)
+
+	//UpdateApprovalSetting approves or unapproves the insight for a container.
+	UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error
+}
+
+var (
+	mu        sync.RWMutex
+	providers = make(map[string]InsightProvider)
+	names     []string
+)
+
+//Register makes an adapter available to the plugin.  It is intended to be called from the init function of the adapter package.
+func Register(provider InsightProvider) {
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if provider == nil {
+		panic("adapters: Register provider is nil")
+	}
+
+	name := provider.Name()
+	if _, dup := providers[name]; dup {
+		panic("adapters: Register called twice for adapter " + name)
+	}
+
+	providers[name] = provider
+	names = append(names, name)
+
+}
+
+//Get returns the adapter registered under the given name.
+func Get(name string) (InsightProvider, error) {
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if provider, ok := providers[name]; ok {
+		return provider, nil
+	}
+
+	return nil, errors.New("adapter [" + name + "] is not registered")
+
+}
+
+//Names returns the names of all registered adapters in registration order.
+func Names() []string {
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return append([]string(nil), names...)
+
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//offline serves insights from the cache only, without contacting the adapter.
+var offline = false
+
+//cacheTTL is how long a cached insight is served before it is fetched again.  Zero disables the cache, apart from serving the insights
+//already cached when offline.
+var cacheTTL time.Duration
+
+//cacheEntry is an insight as it was returned by an adapter.
+type cacheEntry struct {
+	Resources       map[string]map[string]string `json:"resources"`
+	ApprovalSetting string                       `json:"approvalSetting"`
+	FetchedAt       time.Time                    `json:"fetchedAt"`
+}
+
+var (
+	cacheMu      sync.Mutex
+	insightCache = make(map[string]cacheEntry)
+	cacheChanged = false
+)
+
+func init() {
+	support.RegisterSetting("cache-ttl")
+	support.RegisterBoolSetting("offline")
+}
+
+//loadCacheSettings reads the cache-ttl and offline settings, then loads the cache file.
+func loadCacheSettings() error {
+
+	if val, ok := support.Setting("cache-ttl"); ok {
+		ttl, err := time.ParseDuration(val)
+		if err != nil || ttl < 0 {
+			return errors.New("invalid value [" + val + "] for setting cache-ttl -- use a duration, e.g. 1h")
+		}
+		cacheTTL = ttl
+	}
+
+	var err error
+	if offline, err = support.BoolSetting("offline"); err != nil {
+		return err
+	}
+
+	return loadInsightCache()
+
+}
+
+//cacheFile returns the location of the insight cache, under $HELM_CACHE_HOME when helm provides it.
+func cacheFile() (string, error) {
+
+	cacheHome := os.Getenv("HELM_CACHE_HOME")
+	if cacheHome == "" {
+		userCache, err := os.UserCacheDir()
+		if err != nil {
+			return "", errors.New("unable to locate cache directory -- " + err.Error())
+		}
+		cacheHome = filepath.Join(userCache, "helm")
+	}
+
+	return filepath.Join(cacheHome, "optimize", "insights.json"), nil
+
+}
+
+//loadInsightCache reads the cache file.  A missing or unreadable file leaves the cache empty.
+func loadInsightCache() error {
+
+	path, err := cacheFile()
+	if err != nil {
+		return err
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if err := json.Unmarshal(content, &insightCache); err != nil {
+		insightCache = make(map[string]cacheEntry)
+	}
+
+	return nil
+
+}
+
+//saveInsightCache writes the cache file, if any insight was fetched or forgotten since it was loaded.
+func saveInsightCache() error {
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if !cacheChanged {
+		return nil
+	}
+
+	path, err := cacheFile()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(insightCache, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.New("unable to create cache directory [" + filepath.Dir(path) + "]")
+	}
+
+	//write to a temporary file first, so concurrent runs never read a partial cache
+	tmpFile := path + "." + strconv.Itoa(os.Getpid())
+	if err := ioutil.WriteFile(tmpFile, content, 0600); err != nil {
+		return errors.New("unable to write cache file [" + tmpFile + "]")
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		os.Remove(tmpFile)
+		return errors.New("unable to write cache file [" + path + "]")
+	}
+
+	cacheChanged = false
+
+	return nil
+
+}
+
+//insightCacheKey identifies an insight across adapters and clusters.
+func insightCacheKey(cluster string, namespace string, objType string, objName string, containerName string) string {
+	return adapter.Name() + "/" + cluster + "/" + namespace + "/" + objType + "/" + objName + "/" + containerName
+}
+
+//cachedInsight returns the cached insight for a key.  stale is true when the entry is older than the cache-ttl.
+func cachedInsight(key string) (entry cacheEntry, stale bool, ok bool) {
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	entry, ok = insightCache[key]
+
+	return entry, time.Since(entry.FetchedAt) > cacheTTL, ok
+
+}
+
+//cacheInsight records an insight fetched from the adapter.  Nothing is recorded without a cache-ttl, so runs that don't use the cache,
+//e.g. every post-render call, never rewrite the cache file.
+func cacheInsight(key string, entry cacheEntry) {
+
+	if cacheTTL == 0 {
+		return
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	insightCache[key] = entry
+	cacheChanged = true
+
+}
+
+//forgetInsight drops a cached insight, e.g. after its approval setting was changed.
+func forgetInsight(key string) {
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	if _, ok := insightCache[key]; ok {
+		delete(insightCache, key)
+		cacheChanged = true
+	}
+
+}
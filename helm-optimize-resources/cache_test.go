@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInsightCacheFile(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		wantFile bool
+	}{
+		{"no ttl", 0, false},
+		{"ttl", time.Hour, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			setupChartFlow(t, nil, nil, nil)
+			cacheTTL = test.ttl
+			defer func() { cacheTTL = 0 }()
+
+			entry := cacheEntry{map[string]map[string]string{"requests": {"cpu": "250m"}}, "Approved", time.Now()}
+			cacheInsight("Stub/prod/shop/Deployment/web/app", entry)
+			if err := saveInsightCache(); err != nil {
+				t.Fatalf("saveInsightCache() error = %v", err)
+			}
+
+			path, _ := cacheFile()
+			if _, err := os.Stat(path); (err == nil) != test.wantFile {
+				t.Fatalf("cache file exists = %v, want %v", err == nil, test.wantFile)
+			}
+			if !test.wantFile {
+				return
+			}
+
+			//a later run reads the insight back from the file
+			insightCache = make(map[string]cacheEntry)
+			if err := loadInsightCache(); err != nil {
+				t.Fatalf("loadInsightCache() error = %v", err)
+			}
+			cached, stale, ok := cachedInsight("Stub/prod/shop/Deployment/web/app")
+			if !ok || stale || !reflect.DeepEqual(cached.Resources, entry.Resources) {
+				t.Errorf("cachedInsight() = %v, stale %v, found %v, want %v fresh", cached.Resources, stale, ok, entry.Resources)
+			}
+
+			//dropping the insight rewrites the file, even without a ttl
+			cacheTTL = 0
+			forgetInsight("Stub/prod/shop/Deployment/web/app")
+			if err := saveInsightCache(); err != nil {
+				t.Fatalf("saveInsightCache() error = %v", err)
+			}
+			if content, _ := ioutil.ReadFile(path); string(content) != "{}" {
+				t.Errorf("cache file after forgetInsight = %s, want {}", content)
+			}
+
+		})
+	}
+
+}
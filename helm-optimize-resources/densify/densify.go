@@ -4,13 +4,17 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
 	"github.com/densify-quick-start/helm-optimize-resources/support"
-	"golang.org/x/crypto/ssh/terminal"
 )
 
+//Name is the name the Densify adapter is registered and stored under.
+const Name = "Densify"
+
 var (
 	densifyURL  string
 	densifyUser string
@@ -21,30 +25,98 @@ var (
 	systemsEP   = "/CIRBA/api/v2/systems"
 )
 
+//insightKey identifies the analysis result of a container.
+type insightKey struct {
+	namespace      string
+	controllerType string
+	podService     string
+	container      string
+}
+
+//attributeLookup holds the value of an attribute, fetched at most once.
+type attributeLookup struct {
+	once  sync.Once
+	value string
+	err   error
+}
+
+//analysisLookup holds the analysis results of a cluster, fetched at most once.  A nil entry of the index marks a key matched by more than one result.
+type analysisLookup struct {
+	once  sync.Once
+	index map[insightKey]map[string]interface{}
+	err   error
+}
+
+//insightCache holds the analysis results of each cluster, fetched once per run, even when the fetch fails.
+//attributeCache holds the approval setting of each entity, keyed by entityId.
+var (
+	cacheMu        sync.Mutex
+	insightCache   = make(map[string]*analysisLookup)
+	attributeCache = make(map[string]*attributeLookup)
+)
+
+//densifyResources maps each resource of an insight to the fields of an analysis result holding it, e.g. recommendedCpuLimit,
+//and converts the unit the analysis reports it in.
+var densifyResources = []struct {
+	resource string
+	field    string
+	format   func(float64) string
+}{
+	{"cpu", "Cpu", quantity.Millicores},
+	{"memory", "Mem", quantity.Mebibytes},
+}
+
+type adapter struct{}
+
+func init() {
+	adapters.Register(adapter{})
+	support.RegisterSetting("densify-url")
+	support.RegisterSetting("densify-user")
+	support.RegisterSetting("densify-pass")
+}
+
 ////////////////////////////////////////////////////////
 ////////////////EXTERNAL FUNCTIONS//////////////////////
 ////////////////////////////////////////////////////////
 
+//Name returns the name of the adapter
+func (adapter) Name() string {
+	return Name
+}
+
 //Initialize will initilize the densify secrets k8s object, if it doesn't exist in the current-context.
-func Initialize() error {
+func (adapter) Initialize() error {
 
-	//check stored secret
+	//use the stored configuration, with each setting that is supplied taking precedence over its stored value
+	_, explicitURL := support.Setting("densify-url")
 	storedSecrets := support.RetrieveSecrets("helm-optimize-plugin")
-	if storedSecrets != nil && storedSecrets["adapter"] == "Densify" {
+	if storedSecrets != nil && storedSecrets["adapter"] == Name {
 		if _, ok := storedSecrets["densifyURL"]; ok {
 			densifyURL = storedSecrets["densifyURL"]
 			densifyUser = storedSecrets["densifyUser"]
 			densifyPass = storedSecrets["densifyPass"]
+			for key, value := range map[string]*string{"densify-url": &densifyURL, "densify-user": &densifyUser, "densify-pass": &densifyPass} {
+				if val, ok := support.Setting(key); ok {
+					*value = val
+				}
+			}
+			densifyURL = strings.TrimSuffix(densifyURL, "/")
 
 			if err := validateSecrets(); err == nil {
+				if support.Configuring {
+					storeSecrets()
+				}
 				return nil
 			}
 		}
 	}
 
 	//resolve creds from data forwarder
-	support.LoadConfigMap()
-	if support.Config != nil {
+	densifyURL = ""
+	if !explicitURL {
+		support.LoadConfigMap()
+	}
+	if !explicitURL && support.Config != nil {
 
 		var host, protocol, port string
 		var ok bool
@@ -68,7 +140,7 @@ func Initialize() error {
 	}
 
 	//if we can't resolve creds, then fetch from user
-	if densifyURL != "" {
+	if densifyURL != "" && support.CanPrompt("densify-url") {
 		fmt.Println("Densify URL: " + densifyURL)
 		fmt.Print("Is this your Densify URL (y/n)? [y]: ")
 		var correctURL string = ""
@@ -77,19 +149,22 @@ func Initialize() error {
 			densifyURL = ""
 		}
 	}
+
+	var err error
 	if densifyURL == "" {
-		fmt.Print("Enter Densify URL: ")
-		fmt.Scanln(&densifyURL)
+		if densifyURL, err = support.Prompt("densify-url", "Enter Densify URL: "); err != nil {
+			return err
+		}
 		densifyURL = strings.TrimSuffix(densifyURL, "/")
 	}
 
-	fmt.Print("Enter Densify Username: ")
-	fmt.Scanln(&densifyUser)
+	if densifyUser, err = support.Prompt("densify-user", "Enter Densify Username: "); err != nil {
+		return err
+	}
 
-	fmt.Print("Enter Densify Password: ")
-	pass, _ := terminal.ReadPassword(0)
-	densifyPass = string(pass)
-	fmt.Println("")
+	if densifyPass, err = support.PromptPassword("densify-pass", "Enter Densify Password: "); err != nil {
+		return err
+	}
 
 	if err := validateSecrets(); err != nil {
 		support.RemoveSecretData("helm-optimize-plugin", "densifyURL")
@@ -105,42 +180,30 @@ func Initialize() error {
 }
 
 //GetInsight gets an insight from densify based on the keys cluster, namespace, objType, objName and containerName
-func GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+func (adapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
 
 	insight, err := lookupInsight(cluster, namespace, objType, objName, containerName)
 	if err != nil {
 		return nil, "", errors.New("unable to locate resource spec")
 	}
 
-	var insightObj = map[string]map[string]string{}
-	insightObj["limits"] = map[string]string{}
-	insightObj["requests"] = map[string]string{}
-
-	approvalSetting, err := getAttribute(insight["entityId"].(string), "attr_ApprovalSetting")
+	approvalSetting, err := getApprovalAttribute(insight["entityId"].(string))
 	if err != nil {
 		approvalSetting = "Not Approved"
 	}
 
-	if approvalSetting != "Not Approved" && support.InMap(insight, []string{"recommendedCpuLimit", "recommendedMemLimit", "recommendedCpuRequest", "recommendedMemRequest"}) && insight["recommendedCpuLimit"].(float64) > 0 && insight["recommendedMemLimit"].(float64) > 0 && insight["recommendedCpuRequest"].(float64) > 0 && insight["recommendedMemRequest"].(float64) > 0 {
-
-		approvalSetting = "Approved"
-
-		insightObj["limits"]["cpu"] = strconv.FormatFloat(insight["recommendedCpuLimit"].(float64), 'f', -1, 64) + "m"
-		insightObj["limits"]["memory"] = strconv.FormatFloat(insight["recommendedMemLimit"].(float64), 'f', -1, 64) + "Mi"
-		insightObj["requests"]["cpu"] = strconv.FormatFloat(insight["recommendedCpuRequest"].(float64), 'f', -1, 64) + "m"
-		insightObj["requests"]["memory"] = strconv.FormatFloat(insight["recommendedMemRequest"].(float64), 'f', -1, 64) + "Mi"
-
-	} else if approvalSetting == "Not Approved" && support.InMap(insight, []string{"currentCpuLimit", "currentMemLimit", "currentCpuRequest", "currentMemRequest"}) && insight["currentCpuLimit"].(float64) > 0 && insight["currentMemLimit"].(float64) > 0 && insight["currentCpuRequest"].(float64) > 0 && insight["currentMemRequest"].(float64) > 0 {
-
-		insightObj["limits"]["cpu"] = strconv.FormatFloat(insight["currentCpuLimit"].(float64), 'f', -1, 64) + "m"
-		insightObj["limits"]["memory"] = strconv.FormatFloat(insight["currentMemLimit"].(float64), 'f', -1, 64) + "Mi"
-		insightObj["requests"]["cpu"] = strconv.FormatFloat(insight["currentCpuRequest"].(float64), 'f', -1, 64) + "m"
-		insightObj["requests"]["memory"] = strconv.FormatFloat(insight["currentMemRequest"].(float64), 'f', -1, 64) + "Mi"
-
+	var insightObj map[string]map[string]string
+	var ok bool
+	if approvalSetting != "Not Approved" {
+		if insightObj, ok = analysisResources(insight, "recommended"); ok {
+			approvalSetting = "Approved"
+		}
 	} else {
+		insightObj, ok = analysisResources(insight, "current")
+	}
 
+	if !ok {
 		return nil, "", errors.New("invalid resource specs received from repository")
-
 	}
 
 	return insightObj, approvalSetting, nil
@@ -148,32 +211,43 @@ func GetInsight(cluster string, namespace string, objType string, objName string
 }
 
 //UpdateApprovalSetting this will update the approval status for a specific recommendation
-func UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+func (adapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
 
 	insight, err := lookupInsight(cluster, namespace, objType, objName, containerName)
 	if err != nil {
 		return errors.New("unable to update approval setting")
 	}
 
+	approvalSetting := "Not Approved"
 	if approved == true {
-		_, err = support.HTTPRequest("PUT", densifyURL+systemsEP+"/"+insight["entityId"].(string)+"/attributes", densifyUser+":"+densifyPass, []byte("[{\"name\": \"Approval Setting\", \"value\": \"Approve Specific Change\"}]"))
-	} else {
-		_, err = support.HTTPRequest("PUT", densifyURL+systemsEP+"/"+insight["entityId"].(string)+"/attributes", densifyUser+":"+densifyPass, []byte("[{\"name\": \"Approval Setting\", \"value\": \"Not Approved\"}]"))
+		approvalSetting = "Approve Specific Change"
+	}
+
+	entityID := insight["entityId"].(string)
+	if _, err = support.HTTPRequest("PUT", densifyURL+systemsEP+"/"+entityID+"/attributes", densifyUser+":"+densifyPass, []byte("[{\"name\": \"Approval Setting\", \"value\": \""+approvalSetting+"\"}]")); err != nil {
+		return err
 	}
 
-	return err
+	//replace the cached attribute with one that is already resolved to the new value
+	lookup := &attributeLookup{value: approvalSetting}
+	lookup.once.Do(func() {})
+	cacheMu.Lock()
+	attributeCache[entityID] = lookup
+	cacheMu.Unlock()
+
+	return nil
 
 }
 
 //GetApprovalSetting this will update the approval status for a specific recommendation
-func GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+func (adapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
 
 	insight, err := lookupInsight(cluster, namespace, objType, objName, containerName)
 	if err != nil {
 		return "", errors.New("unable to get approval setting")
 	}
 
-	approvalSetting, err := getAttribute(insight["entityId"].(string), "attr_ApprovalSetting")
+	approvalSetting, err := getApprovalAttribute(insight["entityId"].(string))
 	if err != nil {
 		approvalSetting = "Not Approved"
 	}
@@ -190,8 +264,36 @@ func GetApprovalSetting(cluster string, namespace string, objType string, objNam
 ///////////////////LOCAL FUNCTIONS//////////////////////
 ////////////////////////////////////////////////////////
 
+//lookupInsight returns the analysis result of a container.  The first lookup for a cluster fetches the results of the whole analysis, and
+//concurrent lookups wait for that fetch rather than repeating it.
 func lookupInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]interface{}, error) {
 
+	cacheMu.Lock()
+	lookup, ok := insightCache[cluster]
+	if !ok {
+		lookup = &analysisLookup{}
+		insightCache[cluster] = lookup
+	}
+	cacheMu.Unlock()
+
+	lookup.once.Do(func() {
+		lookup.index, lookup.err = loadInsights(cluster)
+	})
+	if lookup.err != nil {
+		return nil, lookup.err
+	}
+
+	if insight := lookup.index[insightKey{namespace, objType, objName, containerName}]; insight != nil {
+		return insight, nil
+	}
+
+	return nil, errors.New("unable to locate insight")
+
+}
+
+//loadInsights fetches every result of the analysis of a cluster and indexes them by container.
+func loadInsights(cluster string) (map[insightKey]map[string]interface{}, error) {
+
 	//locate analysisId if not yet located.
 	if analysisId == "" {
 
@@ -218,19 +320,46 @@ func lookupInsight(cluster string, namespace string, objType string, objName str
 
 	}
 
-	resp, err := support.HTTPRequest("GET", densifyURL+analysisEP+"/"+analysisId+"/results?cluster="+cluster+"&namespace="+namespace+"&container="+containerName+"&podService="+objName+"&controllerType="+objType, densifyUser+":"+densifyPass, nil)
+	resp, err := support.HTTPRequest("GET", densifyURL+analysisEP+"/"+analysisId+"/results", densifyUser+":"+densifyPass, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	var insights []map[string]interface{}
-	json.Unmarshal([]byte(resp), &insights)
+	if err := json.Unmarshal([]byte(resp), &insights); err != nil {
+		return nil, errors.New("unable to parse analysis results")
+	}
 
-	if len(insights) != 1 {
-		return nil, errors.New("unable to locate insight")
+	index := make(map[insightKey]map[string]interface{})
+	for _, insight := range insights {
+		key := insightKey{fmt.Sprint(insight["namespace"]), fmt.Sprint(insight["controllerType"]), fmt.Sprint(insight["podService"]), fmt.Sprint(insight["container"])}
+		if _, dup := index[key]; dup {
+			index[key] = nil
+			continue
+		}
+		index[key] = insight
 	}
 
-	return insights[0], nil
+	return index, nil
+
+}
+
+//getApprovalAttribute returns the approval setting of an entity.  Concurrent lookups of the same entity share a single request.
+func getApprovalAttribute(entityID string) (string, error) {
+
+	cacheMu.Lock()
+	lookup, ok := attributeCache[entityID]
+	if !ok {
+		lookup = &attributeLookup{}
+		attributeCache[entityID] = lookup
+	}
+	cacheMu.Unlock()
+
+	lookup.once.Do(func() {
+		lookup.value, lookup.err = getAttribute(entityID, "attr_ApprovalSetting")
+	})
+
+	return lookup.value, lookup.err
 
 }
 
@@ -254,6 +383,24 @@ func getAttribute(entityID string, attrID string) (string, error) {
 
 }
 
+//analysisResources reads the current or recommended resources of an analysis result.  ok is false unless every resource is greater than 0.
+func analysisResources(insight map[string]interface{}, prefix string) (map[string]map[string]string, bool) {
+
+	resources := map[string]map[string]string{"limits": {}, "requests": {}}
+	for section, suffix := range map[string]string{"limits": "Limit", "requests": "Request"} {
+		for _, r := range densifyResources {
+			val, ok := insight[prefix+r.field+suffix].(float64)
+			if !ok || val <= 0 {
+				return nil, false
+			}
+			resources[section][r.resource] = r.format(val)
+		}
+	}
+
+	return resources, true
+
+}
+
 func validateSecrets() error {
 
 	jsonReq, err := json.Marshal(map[string]string{
@@ -276,7 +423,7 @@ func validateSecrets() error {
 func storeSecrets() {
 
 	storeSecrets := make(map[string]string)
-	storeSecrets["adapter"] = "Densify"
+	storeSecrets["adapter"] = Name
 	storeSecrets["densifyURL"] = densifyURL
 	storeSecrets["densifyUser"] = densifyUser
 	storeSecrets["densifyPass"] = densifyPass
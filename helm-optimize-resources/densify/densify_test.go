@@ -0,0 +1,66 @@
+package densify
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestLookupInsightFetchesOnce(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		results string
+		wantErr bool
+	}{
+		{"results", `[{"namespace": "shop", "controllerType": "Deployment", "podService": "web", "container": "app", "entityId": "e1"}]`, false},
+		{"failed fetch", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				switch {
+				case r.URL.Path == analysisEP:
+					w.Write([]byte(`[{"analysisName": "prod", "analysisId": "a1"}]`))
+				case r.URL.Path == analysisEP+"/a1/results" && test.results != "":
+					w.Write([]byte(test.results))
+				default:
+					w.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer server.Close()
+
+			densifyURL, analysisId = server.URL, ""
+			insightCache = make(map[string]*analysisLookup)
+
+			var wg sync.WaitGroup
+			errs := make([]error, 8)
+			for i := range errs {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_, errs[i] = lookupInsight("prod", "shop", "Deployment", "web", "app")
+				}(i)
+			}
+			wg.Wait()
+
+			//the analysis and its results are requested once, however many workers look them up
+			if requests != 2 {
+				t.Errorf("got %d requests, want 2", requests)
+			}
+			for _, err := range errs {
+				if (err != nil) != test.wantErr {
+					t.Errorf("lookupInsight() error = %v, want error %v", err, test.wantErr)
+				}
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//upgradeOnlyFlags are accepted by helm upgrade but not by helm template, so they are dropped before the chart is rendered.
+var upgradeOnlyFlags = map[string]bool{
+	"--install":         true,
+	"-i":                true,
+	"--reuse-values":    true,
+	"--reset-values":    true,
+	"--force":           true,
+	"--cleanup-on-fail": true,
+}
+
+//diffColumn is a resource compared for each container, titled for the console and for markdown.
+type diffColumn struct {
+	title    string
+	heading  string
+	section  string
+	resource string
+}
+
+//diffColumns are the resources always compared for each container.
+var diffColumns = []diffColumn{
+	{"CPU REQUEST", "CPU Request", "requests", "cpu"},
+	{"CPU LIMIT", "CPU Limit", "limits", "cpu"},
+	{"MEMORY REQUEST", "Memory Request", "requests", "memory"},
+	{"MEMORY LIMIT", "Memory Limit", "limits", "memory"},
+}
+
+//resultColumns returns the diffColumns, followed by a column for every other resource set on a container, e.g. ephemeral-storage or nvidia.com/gpu.
+func resultColumns(results []containerResult) []diffColumn {
+
+	columns := append([]diffColumn{}, diffColumns...)
+	known := map[string]bool{}
+	for _, column := range diffColumns {
+		known[column.section+"/"+column.resource] = true
+	}
+
+	var extra []diffColumn
+	for _, result := range results {
+		for _, resources := range []map[string]map[string]string{result.original, result.resources} {
+			for _, section := range []string{"requests", "limits"} {
+				for resource := range resources[section] {
+					if known[section+"/"+resource] {
+						continue
+					}
+					known[section+"/"+resource] = true
+					suffix := "Request"
+					if section == "limits" {
+						suffix = "Limit"
+					}
+					extra = append(extra, diffColumn{strings.ToUpper(resource + " " + suffix), resource + " " + suffix, section, resource})
+				}
+			}
+		}
+	}
+
+	//requests before limits, as for cpu and memory
+	sort.Slice(extra, func(i, j int) bool {
+		if extra[i].resource != extra[j].resource {
+			return extra[i].resource < extra[j].resource
+		}
+		return extra[i].section > extra[j].section
+	})
+
+	return append(columns, extra...)
+
+}
+
+//diffChart renders the chart for an install or upgrade command and prints the resource changes the plugin would make, without applying anything.
+func diffChart(args []string) error {
+
+	if len(args) == 0 || (args[0] != "install" && args[0] != "upgrade") {
+		return errors.New("incorrect optimize-plugin command -- try helm optimize diff (install/upgrade) [NAME] [CHART] [flags]")
+	}
+
+	stdOut, stdErr, err := support.ExecuteSingleCommand(templateCommand(args))
+	if err != nil {
+		return errors.New(stdErr)
+	}
+
+	var lookups []lookup
+	for _, doc := range parseStream(stdOut, "") {
+		for _, workload := range doc.workloads {
+			for _, container := range workload.containers {
+				lookups = append(lookups, lookup{doc.chart, workload, container})
+			}
+		}
+	}
+
+	results = append(results, resolveContainers(lookups)...)
+	printDiff(results)
+
+	return nil
+
+}
+
+//templateCommand returns the helm template command rendering the chart of an install, upgrade or template command, without the flags
+//helm template doesn't accept.
+func templateCommand(args []string) []string {
+
+	templateArgs := []string{HelmBin, "template"}
+	for i := 1; i < len(args); i++ {
+		if upgradeOnlyFlags[strings.SplitN(args[i], "=", 2)[0]] {
+			continue
+		}
+		if args[i] == "--history-max" {
+			i++
+			continue
+		}
+		if strings.HasPrefix(args[i], "--history-max=") {
+			continue
+		}
+		templateArgs = append(templateArgs, args[i])
+	}
+
+	return templateArgs
+
+}
+
+//printDiff writes a table of the original and injected resources of each container.
+func printDiff(results []containerResult) {
+
+	w := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+
+	columns := resultColumns(results)
+	header := "NAMESPACE\tKIND\tNAME\tCONTAINER\tSOURCE"
+	for _, column := range columns {
+		header += "\t" + column.title
+	}
+	fmt.Fprintln(w, header)
+
+	for _, result := range results {
+		row := result.namespace + "\t" + result.objType + "\t" + result.objName + "\t" + result.displayName() + "\t" + result.source
+		for _, column := range columns {
+			row += "\t" + diffCell(result.original[column.section][column.resource], result.resources[column.section][column.resource])
+		}
+		fmt.Fprintln(w, row)
+	}
+
+	w.Flush()
+
+	//explain why an insight was clamped or rejected by the policy, or changed when it was merged into the template
+	for _, result := range results {
+		name := result.namespace + "/" + result.objType + "/" + result.objName + "/" + result.displayName()
+		for _, note := range result.policyNotes {
+			fmt.Fprintln(out, name+": clamped, "+note)
+		}
+		for _, note := range result.mergeNotes {
+			fmt.Fprintln(out, name+": merged, "+note)
+		}
+		if result.repositoryErr != nil && strings.HasPrefix(result.repositoryErr.Error(), "rejected by policy") {
+			fmt.Fprintln(out, name+": "+result.repositoryErr.Error())
+		}
+	}
+
+}
+
+//diffCell formats the change of a single resource, e.g. "100m -> 250m (+150%)".
+func diffCell(before string, after string) string {
+
+	if before == "" {
+		before = "-"
+	}
+	if after == "" {
+		after = "-"
+	}
+
+	if before == after {
+		return before
+	}
+
+	cell := before + " -> " + after
+	if change, ok := percentChange(before, after); ok {
+		cell += " (" + change + ")"
+	}
+
+	return cell
+
+}
+
+//percentChange returns the change between two quantities as a signed percentage.
+func percentChange(before string, after string) (string, bool) {
+
+	beforeVal, err := quantity.Value(before)
+	if err != nil || beforeVal == 0 {
+		return "", false
+	}
+
+	afterVal, err := quantity.Value(after)
+	if err != nil {
+		return "", false
+	}
+
+	change := (afterVal - beforeVal) / beforeVal * 100
+	sign := ""
+	if change >= 0 {
+		sign = "+"
+	}
+
+	return sign + strconv.FormatFloat(change, 'f', 0, 64) + "%", true
+
+}
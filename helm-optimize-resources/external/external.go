@@ -0,0 +1,235 @@
+package external
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"sort"
+
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//APIVersion is the version of the protocol spoken with external adapters.  Responses must carry the same version.
+const APIVersion = "adapter.optimize.densify.com/v1"
+
+//Operations sent to an external adapter.
+const (
+	opInitialize            = "initialize"
+	opGetInsight            = "getInsight"
+	opGetApprovalSetting    = "getApprovalSetting"
+	opUpdateApprovalSetting = "updateApprovalSetting"
+)
+
+//request is written to the stdin of the executable, one request per run.
+type request struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Operation  string `json:"operation"`
+	Cluster    string `json:"cluster,omitempty"`
+	Namespace  string `json:"namespace,omitempty"`
+	ObjType    string `json:"objType,omitempty"`
+	ObjName    string `json:"objName,omitempty"`
+	Container  string `json:"container,omitempty"`
+	Approved   *bool  `json:"approved,omitempty"`
+}
+
+//response is read from the stdout of the executable.
+type response struct {
+	APIVersion string                            `json:"apiVersion"`
+	Kind       string                            `json:"kind"`
+	Insight    map[string]map[string]interface{} `json:"insight,omitempty"`
+	Approval   string                            `json:"approval,omitempty"`
+	Error      string                            `json:"error,omitempty"`
+}
+
+//adapter serves insights from an executable, registered under the name it was given in the external-adapters setting.
+type adapter struct {
+	name       string
+	executable string
+}
+
+func init() {
+	support.RegisterSetting("external-adapters")
+}
+
+////////////////////////////////////////////////////////
+////////////////EXTERNAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//RegisterAdapters registers the executables declared in the external-adapters setting, e.g. --external-adapters=CapacityDB=/usr/local/bin/capacity-adapter.
+//Each value is the path of the executable as a whole, so it may contain spaces, and is run without arguments.
+//The executables only ever come from the flags, environment or config file of the local machine, never from the cluster, as they are run
+//locally.  It must be called once the settings are parsed.
+func RegisterAdapters() error {
+
+	declared, _, err := support.SettingMap("external-adapters")
+	if err != nil {
+		return err
+	}
+
+	//registered in name order, so they are always listed in the same order
+	var names []string
+	for name := range declared {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		executable := declared[name]
+		if executable == "" {
+			return errors.New("invalid value [" + name + "=] for setting external-adapters -- expected <name>=<executable>")
+		}
+		if _, err := exec.LookPath(executable); err != nil {
+			return errors.New("executable [" + executable + "] of external adapter " + name + " not found")
+		}
+		if _, err := adapters.Get(name); err == nil {
+			return errors.New("external adapter " + name + " has the name of a registered adapter")
+		}
+		adapters.Register(adapter{name: name, executable: executable})
+	}
+
+	return nil
+
+}
+
+//Name returns the name of the adapter
+func (a adapter) Name() string {
+	return a.name
+}
+
+//Initialize will ask the executable to ready itself.  Its configuration is left to the executable, e.g. through its environment.
+func (a adapter) Initialize() error {
+
+	if _, err := a.call(request{Operation: opInitialize}); err != nil {
+		return err
+	}
+
+	//only the name is stored, the executable has to be declared on every machine that uses it
+	if support.Configuring {
+		a.storeSecrets()
+	}
+
+	return nil
+
+}
+
+//GetInsight gets an insight from the executable based on the keys cluster, namespace, objType, objName and containerName
+func (a adapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+
+	resp, err := a.call(request{Operation: opGetInsight, Cluster: cluster, Namespace: namespace, ObjType: objType, ObjName: objName, Container: containerName})
+	if err != nil {
+		return nil, "", err
+	}
+
+	insightObj := map[string]map[string]string{}
+	for section, resources := range resp.Insight {
+		if section != "limits" && section != "requests" {
+			return nil, "", errors.New("invalid resource specs received from repository -- unknown section [" + section + "]")
+		}
+		if len(resources) == 0 {
+			continue
+		}
+		insightObj[section] = map[string]string{}
+		for resource, val := range resources {
+			canonical, err := quantity.Canonical(resource, fmt.Sprint(val))
+			if err != nil {
+				return nil, "", errors.New("invalid resource specs received from repository -- " + err.Error())
+			}
+			insightObj[section][resource] = canonical
+		}
+	}
+	if len(insightObj) == 0 {
+		return nil, "", errors.New("invalid resource specs received from repository")
+	}
+
+	approvalSetting, err := approvalSetting(resp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return insightObj, approvalSetting, nil
+
+}
+
+//UpdateApprovalSetting will ask the executable to approve or unapprove the insight
+func (a adapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+
+	if _, err := a.call(request{Operation: opUpdateApprovalSetting, Cluster: cluster, Namespace: namespace, ObjType: objType, ObjName: objName, Container: containerName, Approved: &approved}); err != nil {
+		return errors.New("unable to update approval setting -- " + err.Error())
+	}
+
+	return nil
+
+}
+
+//GetApprovalSetting will acquire the current approval setting
+func (a adapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+
+	resp, err := a.call(request{Operation: opGetApprovalSetting, Cluster: cluster, Namespace: namespace, ObjType: objType, ObjName: objName, Container: containerName})
+	if err != nil {
+		return "", errors.New("unable to read approval setting -- " + err.Error())
+	}
+
+	return approvalSetting(resp)
+
+}
+
+////////////////////////////////////////////////////////
+///////////////////LOCAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//call runs the executable with the request on stdin and parses the response from stdout.  An error reported by the executable is returned as an error.
+func (a adapter) call(req request) (response, error) {
+
+	req.APIVersion, req.Kind = APIVersion, "AdapterRequest"
+	input, err := json.Marshal(req)
+	if err != nil {
+		return response{}, err
+	}
+
+	stdOut, stdErr, err := support.ExecuteCommandWithInput([]string{a.executable}, string(input))
+	if err != nil {
+		if stdErr != "" {
+			return response{}, errors.New("external adapter " + a.name + " failed -- " + stdErr)
+		}
+		return response{}, errors.New("external adapter " + a.name + " failed -- " + err.Error())
+	}
+
+	var resp response
+	if err := json.Unmarshal([]byte(stdOut), &resp); err != nil {
+		return response{}, errors.New("unable to parse the response of external adapter " + a.name)
+	}
+	if resp.APIVersion != APIVersion {
+		return response{}, errors.New("external adapter " + a.name + " responded with apiVersion [" + resp.APIVersion + "] -- expected " + APIVersion)
+	}
+	if resp.Kind != "AdapterResponse" {
+		return response{}, errors.New("external adapter " + a.name + " responded with kind [" + resp.Kind + "] -- expected AdapterResponse")
+	}
+	if resp.Error != "" {
+		return response{}, errors.New(resp.Error)
+	}
+
+	return resp, nil
+
+}
+
+func approvalSetting(resp response) (string, error) {
+
+	if resp.Approval != "Approved" && resp.Approval != "Not Approved" {
+		return "", errors.New("invalid approval setting [" + resp.Approval + "] received from repository -- expected Approved or Not Approved")
+	}
+
+	return resp.Approval, nil
+
+}
+
+func (a adapter) storeSecrets() {
+
+	secrets := make(map[string]string)
+	secrets["adapter"] = a.name
+	support.StoreSecrets("helm-optimize-plugin", secrets)
+
+}
@@ -3,8 +3,15 @@ module github.com/densify-quick-start/helm-optimize-resources
 go 1.16
 
 require (
+	github.com/aws/aws-sdk-go v1.38.68
 	github.com/ghodss/yaml v1.0.0
+	github.com/json-iterator/go v1.1.12 // indirect
 	github.com/magiconair/properties v1.8.4
+	github.com/modern-go/reflect2 v1.0.2 // indirect
 	golang.org/x/crypto v0.0.0-20210220033148-5ea612d1eb83
 	gopkg.in/yaml.v2 v2.4.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1
+	k8s.io/api v0.20.15
+	k8s.io/apimachinery v0.20.15
+	k8s.io/client-go v0.20.15
 )
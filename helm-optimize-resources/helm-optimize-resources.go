@@ -1,9 +1,9 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -12,18 +12,22 @@ import (
 	"strings"
 	"time"
 
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
 	"github.com/densify-quick-start/helm-optimize-resources/densify"
-	"github.com/densify-quick-start/helm-optimize-resources/ssm"
+	"github.com/densify-quick-start/helm-optimize-resources/external"
+	_ "github.com/densify-quick-start/helm-optimize-resources/kubestore"
+	_ "github.com/densify-quick-start/helm-optimize-resources/localfile"
+	_ "github.com/densify-quick-start/helm-optimize-resources/prometheus"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	_ "github.com/densify-quick-start/helm-optimize-resources/ssm"
 	"github.com/densify-quick-start/helm-optimize-resources/support"
+	_ "github.com/densify-quick-start/helm-optimize-resources/vault"
+	_ "github.com/densify-quick-start/helm-optimize-resources/vpa"
 	"github.com/ghodss/yaml"
 )
 
 //VARIABLE DECLARATIONS
-var availableAdapters = map[int]string{
-	1: "Densify",
-	2: "Parameter Store",
-}
-var adapter string
+var adapter adapters.InsightProvider
 var localCluster string
 var remoteCluster string
 var namespace string
@@ -38,11 +42,26 @@ var objTypeContainerPath = map[string]string{
 	"Deployment":            "{.spec.template.spec.containers}",
 }
 
+//includeInitContainers controls whether initContainers are optimized alongside the regular containers.
+//Ephemeral containers are never optimized, as k8s does not allow them to set resources.
+var includeInitContainers = true
+
+//out is where console output is written.  In post-render mode stdout carries the manifests, so it is switched to stderr.
+var out io.Writer = os.Stdout
+
+//manifestOut is where post-render writes the optimized manifests.
+var manifestOut io.Writer = os.Stdout
+
 //HelmBin location of helm installation
 var HelmBin string = os.Getenv("HELM_BIN")
 
-//KubectlBin location of kubectl installation
-var KubectlBin string = "kubectl"
+func init() {
+	support.RegisterSetting("adapter")
+	support.RegisterSetting("remote-cluster")
+	support.RegisterSetting("approval")
+	support.RegisterSetting("init-containers")
+	support.RegisterSetting("workload-kinds")
+}
 
 ////////////////////////////////////////////////////////
 /////////////////ADAPTER FUNCTIONS//////////////////////
@@ -50,23 +69,29 @@ var KubectlBin string = "kubectl"
 
 func initializeAdapter() error {
 
-	if adapter == "" {
-		if val, ok := support.RetrieveSecrets("helm-optimize-plugin")["adapter"]; ok {
-			adapter = val
-		} else {
-			adapter = "Densify"
+	if adapter == nil {
+		adapterName := densify.Name
+		if val, ok := support.Setting("adapter"); ok {
+			adapterName = val
+		} else if val, ok := support.RetrieveSecrets("helm-optimize-plugin")["adapter"]; ok {
+			adapterName = val
+		}
+
+		var err error
+		if adapter, err = adapters.Get(adapterName); err != nil {
+			fmt.Println(err)
+			return err
 		}
 	}
 
-	var err error
-	switch adapter {
-	case "Densify":
-		err = densify.Initialize()
-	case "Parameter Store":
-		err = ssm.Initialize()
+	//offline, insights are only served from the cache
+	if offline {
+		return nil
 	}
 
-	if err != nil {
+	err := adapter.Initialize()
+
+	if err != nil && !support.NonInteractive {
 		fmt.Println(err)
 		var tryAgain string
 		fmt.Print("Would you like to try again (y/n): ")
@@ -74,6 +99,8 @@ func initializeAdapter() error {
 		if tryAgain == "y" {
 			return initializeAdapter()
 		}
+	} else if err != nil {
+		fmt.Println(err)
 	}
 
 	return err
@@ -82,17 +109,7 @@ func initializeAdapter() error {
 
 func getInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
 
-	var insight map[string]map[string]string
-	var approvalSetting string
-	var err error
-
-	switch adapter {
-	case "Densify":
-		insight, approvalSetting, err = densify.GetInsight(cluster, namespace, objType, objName, containerName)
-	case "Parameter Store":
-		insight, approvalSetting, err = ssm.GetInsight(cluster, namespace, objType, objName, containerName)
-	}
-
+	insight, approvalSetting, err := adapter.GetInsight(cluster, namespace, objType, objName, containerName)
 	if err != nil {
 		return nil, "Not Approved", err
 	}
@@ -103,32 +120,23 @@ func getInsight(cluster string, namespace string, objType string, objName string
 
 func updateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
 
-	var err error
-
-	switch adapter {
-	case "Densify":
-		err = densify.UpdateApprovalSetting(approved, cluster, namespace, objType, objName, containerName)
-	case "Parameter Store":
-		err = ssm.UpdateApprovalSetting(approved, cluster, namespace, objType, objName, containerName)
+	if offline {
+		return errors.New("approval settings can't be updated offline")
 	}
 
-	return err
+	forgetInsight(insightCacheKey(cluster, namespace, objType, objName, containerName))
+
+	return adapter.UpdateApprovalSetting(approved, cluster, namespace, objType, objName, containerName)
 
 }
 
 func getApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
 
-	var approvalSetting string
-	var err error
-
-	switch adapter {
-	case "Densify":
-		approvalSetting, err = densify.GetApprovalSetting(cluster, namespace, objType, objName, containerName)
-	case "Parameter Store":
-		approvalSetting, err = ssm.GetApprovalSetting(cluster, namespace, objType, objName, containerName)
+	if offline {
+		return "", errors.New("approval settings can't be read offline")
 	}
 
-	return approvalSetting, err
+	return adapter.GetApprovalSetting(cluster, namespace, objType, objName, containerName)
 
 }
 
@@ -136,15 +144,25 @@ func getApprovalSetting(cluster string, namespace string, objType string, objNam
 /////////////////SUPPORTING FUNCTIONS///////////////////
 ////////////////////////////////////////////////////////
 
-func selectAdapter() {
+func selectAdapter() error {
+
+	//use the adapter supplied as a setting
+	if val, ok := support.Setting("adapter"); ok {
+		var err error
+		adapter, err = adapters.Get(val)
+		return err
+	}
+
+	if support.NonInteractive {
+		return support.MissingSettingError("adapter")
+	}
 
 	//get adapter selection from user
 	for {
+		availableAdapters := adapters.Names()
 		fmt.Println("Select Adapter")
-		i := 1
-		for range availableAdapters {
-			fmt.Println("  " + strconv.Itoa(i) + ". " + availableAdapters[i])
-			i++
+		for i, name := range availableAdapters {
+			fmt.Println("  " + strconv.Itoa(i+1) + ". " + name)
 		}
 		fmt.Print("Selection: ")
 
@@ -157,10 +175,12 @@ func selectAdapter() {
 			fmt.Println("Incorrect adapter selection.  Try again.")
 			continue
 		}
-		adapter = availableAdapters[userSelection]
+		adapter, _ = adapters.Get(availableAdapters[userSelection-1])
 		break
 	}
 
+	return nil
+
 }
 
 func processPluginSwitches(args []string) {
@@ -174,19 +194,25 @@ func processPluginSwitches(args []string) {
 	if args[0] == "-c" && len(args) == 2 {
 		//Check if user is configuring adapter
 		if args[1] == "--adapter" {
-			selectAdapter()
-			initializeAdapter()
+			support.Configuring = true
+			if err := selectAdapter(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if err := initializeAdapter(); err != nil {
+				os.Exit(1)
+			}
 			os.Exit(0)
 		}
 
 		//Check if user is configuring adapter
 		if args[1] == "--cluster-mapping" {
-			remoteCluster = ""
-			fmt.Print("Please specify remote cluster [" + localCluster + "]: ")
-			fmt.Scanln(&remoteCluster)
-			if remoteCluster == "" {
-				remoteCluster = localCluster
+			//the local cluster is only a guess at the name used by the repository, so it is never taken silently
+			if _, ok := support.Setting("remote-cluster"); !ok && support.NonInteractive {
+				fmt.Println(support.MissingSettingError("remote-cluster"))
+				os.Exit(1)
 			}
+			remoteCluster = support.PromptDefault("remote-cluster", "Please specify remote cluster ["+localCluster+"]: ", localCluster)
 			support.StoreSecrets("helm-optimize-plugin", map[string]string{"remoteCluster": remoteCluster})
 			os.Exit(0)
 		}
@@ -202,8 +228,18 @@ func processPluginSwitches(args []string) {
 
 	if args[0] == "-a" && len(args) > 1 {
 
+		//in non-interactive mode the answer for every container comes from the approval setting
+		approvalAction, approvalSupplied := support.Setting("approval")
+		if approvalSupplied && approvalAction != "approve" && approvalAction != "unapprove" {
+			fmt.Println("invalid value [" + approvalAction + "] for setting approval -- use approve or unapprove")
+			os.Exit(1)
+		} else if !approvalSupplied && support.NonInteractive {
+			fmt.Println(support.MissingSettingError("approval"))
+			os.Exit(1)
+		}
+
 		if err := initializeAdapter(); err != nil {
-			os.Exit(0)
+			os.Exit(1)
 		}
 
 		stdOut, stdErr, err := support.ExecuteSingleCommand(append([]string{HelmBin, "template"}, args[1:]...))
@@ -212,48 +248,125 @@ func processPluginSwitches(args []string) {
 		support.PrintCharAcrossScreen("-")
 		fmt.Println("LOCAL CLUSTER: " + localCluster)
 		fmt.Println("REMOTE CLUSTER: " + remoteCluster)
-		fmt.Println("ADAPTER: " + adapter)
+		fmt.Println("ADAPTER: " + adapter.Name())
 
-		for _, manifest := range strings.Split(stdOut, "---") {
+		for _, manifest := range splitManifests(stdOut) {
 
-			objType, objName, objNamespace, containers, _, err := validateManifest([]byte(manifest))
+			workloads, _, err := validateManifest([]byte(manifest))
 			if err != nil {
 				continue
 			}
 
-			fmt.Println("\nnamespace[" + objNamespace + "] objType[" + objType + "] objName[" + objName + "]")
-			for i, container := range containers {
+			for _, workload := range workloads {
 
-				containerName := container.(map[string]interface{})["name"].(string)
-				approvalSetting, err := getApprovalSetting(remoteCluster, objNamespace, objType, objName, containerName)
-				if err != nil {
-					fmt.Println(strconv.Itoa(i+1) + "." + containerName + " not found in repository.")
-					continue
-				}
-				fmt.Print(strconv.Itoa(i+1) + "." + containerName + " [" + approvalSetting + "] ")
-				var approval string
-				if approvalSetting == "Not Approved" {
-					fmt.Print("Approve this insight (y/n) [y]: ")
-					fmt.Scanln(&approval)
-					if approval == "y" || approval == "" {
-						if err := updateApprovalSetting(true, remoteCluster, objNamespace, objType, objName, containerName); err != nil {
-							fmt.Print("  " + err.Error())
-						}
+				fmt.Println("\nnamespace[" + workload.objNamespace + "] objType[" + workload.objType + "] objName[" + workload.objName + "]")
+				for i, container := range workload.containers {
+
+					containerName := support.CheckMap(container.spec, "name")
+					approvalSetting, err := getApprovalSetting(remoteCluster, workload.objNamespace, workload.objType, workload.objName, containerName)
+					if err != nil {
+						fmt.Println(strconv.Itoa(i+1) + "." + container.name() + " not found in repository.")
+						continue
 					}
-				} else {
-					fmt.Print("Unapprove this insight (y/n) [y]: ")
-					fmt.Scanln(&approval)
-					if approval == "y" || approval == "" {
-						if err := updateApprovalSetting(false, remoteCluster, objNamespace, objType, objName, containerName); err != nil {
-							fmt.Print("  " + err.Error())
+					fmt.Print(strconv.Itoa(i+1) + "." + container.name() + " [" + approvalSetting + "] ")
+					var approval string
+					if approvalSetting == "Not Approved" {
+						if approvalSupplied {
+							if approvalAction != "approve" {
+								fmt.Println("unchanged")
+								continue
+							}
+							fmt.Println("approving")
+						} else {
+							fmt.Print("Approve this insight (y/n) [y]: ")
+							fmt.Scanln(&approval)
+						}
+						if approval == "y" || approval == "" {
+							if err := updateApprovalSetting(true, remoteCluster, workload.objNamespace, workload.objType, workload.objName, containerName); err != nil {
+								fmt.Print("  " + err.Error())
+							}
+						}
+					} else {
+						if approvalSupplied {
+							if approvalAction != "unapprove" {
+								fmt.Println("unchanged")
+								continue
+							}
+							fmt.Println("unapproving")
+						} else {
+							fmt.Print("Unapprove this insight (y/n) [y]: ")
+							fmt.Scanln(&approval)
+						}
+						if approval == "y" || approval == "" {
+							if err := updateApprovalSetting(false, remoteCluster, workload.objNamespace, workload.objType, workload.objName, containerName); err != nil {
+								fmt.Print("  " + err.Error())
+							}
 						}
 					}
+
 				}
 
 			}
 		}
 
 		support.PrintCharAcrossScreen("-")
+
+		//write out the insights forgotten above, so the next run fetches them with their new approval setting
+		err = saveInsightCache()
+		support.CheckError("", err, true)
+		os.Exit(0)
+
+	}
+
+	if args[0] == "diff" {
+
+		if err := initializeAdapter(); err != nil {
+			os.Exit(1)
+		}
+
+		support.PrintCharAcrossScreen("-")
+		fmt.Println("LOCAL CLUSTER: " + localCluster)
+		fmt.Println("REMOTE CLUSTER: " + remoteCluster)
+		fmt.Println("ADAPTER: " + adapter.Name() + "\n")
+
+		err := diffChart(args[1:])
+		support.CheckError("", err, true)
+		support.PrintCharAcrossScreen("-")
+
+		err = writeReport()
+		support.CheckError("", err, true)
+		os.Exit(0)
+
+	}
+
+	if args[0] == "post-render" {
+
+		for i := 1; i < len(args); i++ {
+			if (args[i] == "-n" || args[i] == "--namespace") && i+1 < len(args) {
+				namespace = args[i+1]
+				i++
+			} else if strings.HasPrefix(args[i], "--namespace=") {
+				namespace = strings.TrimPrefix(args[i], "--namespace=")
+			}
+		}
+
+		//read the stream before the adapter is initialized, so stdin is never mistaken for user input
+		stream, err := ioutil.ReadAll(os.Stdin)
+		support.CheckError("unable to read rendered manifests from stdin", err, true)
+
+		if err := initializeAdapter(); err != nil {
+			os.Exit(1)
+		}
+
+		fmt.Fprintln(out, "LOCAL CLUSTER: "+localCluster)
+		fmt.Fprintln(out, "REMOTE CLUSTER: "+remoteCluster)
+		fmt.Fprintln(out, "ADAPTER: "+adapter.Name()+"\n")
+
+		err = postRender(stream, manifestOut)
+		support.CheckError("", err, true)
+
+		err = writeReport()
+		support.CheckError("", err, true)
 		os.Exit(0)
 
 	}
@@ -261,7 +374,7 @@ func processPluginSwitches(args []string) {
 	//Check for errors
 	if args[0] == "-c" || args[0] == "-a" {
 		fmt.Println("incorrect optimize-plugin command - refer to help menu")
-		os.Exit(0)
+		os.Exit(1)
 	}
 
 }
@@ -286,20 +399,11 @@ func printHowToUse() error {
 
 func checkGeneralDependancies() {
 
-	for {
-		if _, _, err := support.ExecuteSingleCommand([]string{KubectlBin}); err != nil {
-			fmt.Print("[" + KubectlBin + "] is not available -- enter new path: ")
-			fmt.Scanln(&KubectlBin)
-			fmt.Println("")
-		} else {
-			if stdOut, stdErr, err := support.ExecuteSingleCommand([]string{KubectlBin, "cluster-info"}); err != nil {
-				fmt.Println(stdOut)
-				fmt.Println(stdErr)
-				os.Exit(0)
-			}
-			support.KubectlBin = KubectlBin
-			break
-		}
+	support.KubeContext = os.Getenv("HELM_KUBECONTEXT")
+
+	if err := support.CheckKubeConnection(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
 	}
 
 }
@@ -378,7 +482,40 @@ func main() {
 	startTime := time.Now()
 
 	//set environment variables
-	args := os.Args[1:]
+	args, err := support.ParseSettings(os.Args[1:])
+
+	//in post-render mode stdin and stdout carry the manifests, so nothing is prompted for and all console output,
+	//including that of the adapters, goes to stderr
+	if len(args) > 0 && args[0] == "post-render" {
+		support.NonInteractive = true
+		manifestOut = os.Stdout
+		os.Stdout = os.Stderr
+		out = os.Stderr
+	}
+	support.CheckError("", err, true)
+
+	if val, ok := support.Setting("init-containers"); ok {
+		includeInitContainers, err = strconv.ParseBool(val)
+		support.CheckError("invalid value ["+val+"] for setting init-containers", err, true)
+	}
+
+	err = loadWorkloadKinds()
+	support.CheckError("", err, true)
+
+	err = external.RegisterAdapters()
+	support.CheckError("", err, true)
+
+	err = loadLookupSettings()
+	support.CheckError("", err, true)
+
+	err = loadCacheSettings()
+	support.CheckError("", err, true)
+
+	err = loadPolicySettings()
+	support.CheckError("", err, true)
+
+	err = loadMergeSettings()
+	support.CheckError("", err, true)
 
 	if !(len(args) == 1 && args[0] == "-h") {
 		checkGeneralDependancies()
@@ -387,9 +524,9 @@ func main() {
 	processPluginSwitches(args)
 
 	//initialize the adapter
-	if adapter == "" {
+	if adapter == nil {
 		if err := initializeAdapter(); err != nil {
-			os.Exit(0)
+			os.Exit(1)
 		}
 	}
 
@@ -401,82 +538,145 @@ func main() {
 		fmt.Println(stdOut)
 		os.Exit(0)
 
-	} else {
+	}
 
-		//validate whether the command is legal
-		_, stdErr, err := support.ExecuteSingleCommand(append(append([]string{HelmBin}, args...), "--dry-run"))
-		support.CheckError(stdErr, err, true)
+	err = optimizeRelease(args, startTime)
+	support.CheckError("", err, true)
 
-		chart, argPos, err := scanFlagsForChartDetails(os.Args[1:])
-		support.CheckError("", err, true)
+}
 
-		support.PrintCharAcrossScreen("-")
-		fmt.Println("LOCAL CLUSTER: " + localCluster)
-		fmt.Println("REMOTE CLUSTER: " + remoteCluster)
-		fmt.Println("ADAPTER: " + adapter + "\n")
+//optimizeRelease renders the chart of an install, upgrade or template command into a temporary directory, optimizes the rendered
+//templates and runs the command against the optimized copy of the chart.
+func optimizeRelease(args []string, startTime time.Time) error {
 
-		absChartPath, _ := filepath.Abs(chart)
-		chartDirName := filepath.Base(absChartPath)
+	//validate whether the command is legal
+	_, stdErr, err := support.ExecuteSingleCommand(append(append([]string{HelmBin}, args...), "--dry-run"))
+	if err != nil {
+		return errors.New(stdErr)
+	}
 
-		//create temporary chart directory
-		tempChartDir, err := ioutil.TempDir("", "")
-		support.CheckError("", err, true)
+	chart, argPos, err := scanFlagsForChartDetails(args)
+	if err != nil {
+		return err
+	}
 
-		//check to see if valid chart directory passed in.
-		//if not pull from repo
-		if support.FileExists(chart + "/Chart.yaml") {
-			_, stdErr, err := support.ExecuteSingleCommand([]string{"cp", "-a", absChartPath, tempChartDir})
-			support.CheckError(stdErr, err, true)
-		} else {
-			_, stdErr, err := support.ExecuteSingleCommand([]string{HelmBin, "pull", chart, "--untar", "--untardir", tempChartDir})
-			support.CheckError(stdErr, err, true)
-		}
+	support.PrintCharAcrossScreen("-")
+	fmt.Println("LOCAL CLUSTER: " + localCluster)
+	fmt.Println("REMOTE CLUSTER: " + remoteCluster)
+	fmt.Println("ADAPTER: " + adapter.Name() + "\n")
 
-		chartYaml, err := ioutil.ReadFile(tempChartDir + "/" + chartDirName + "/Chart.yaml")
-		support.CheckError("", err, true)
+	absChartPath, _ := filepath.Abs(chart)
+	chartDirName := filepath.Base(absChartPath)
 
-		var chartMap map[string]interface{}
-		err = yaml.Unmarshal([]byte(chartYaml), &chartMap)
-		support.CheckError("", err, true)
+	//create temporary chart directory
+	tempChartDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return err
+	}
 
-		//render chart and output to temporary directory
-		_, stdErr, err = support.ExecuteSingleCommand(append(append([]string{HelmBin, "template"}, args[1:]...), "--output-dir", tempChartDir))
-		support.CheckError(stdErr, err, true)
+	//check to see if valid chart directory passed in.
+	//if not pull from repo
+	if support.FileExists(chart + "/Chart.yaml") {
+		_, stdErr, err = support.ExecuteSingleCommand([]string{"cp", "-a", absChartPath, tempChartDir})
+	} else {
+		_, stdErr, err = support.ExecuteSingleCommand([]string{HelmBin, "pull", chart, "--untar", "--untardir", tempChartDir})
+	}
+	if err != nil {
+		return errors.New(stdErr)
+	}
 
-		//check if rendered charts are in diff directory.  if they are copy them to temp directory.
-		if chartDirName != chartMap["name"].(string) {
-			_, stdErr, err := support.ExecuteSingleCommand([]string{"cp", "-a", tempChartDir + "/" + chartMap["name"].(string) + "/.", tempChartDir + "/" + chartDirName})
-			support.CheckError(stdErr, err, true)
-		}
+	chartYaml, err := ioutil.ReadFile(tempChartDir + "/" + chartDirName + "/Chart.yaml")
+	if err != nil {
+		return err
+	}
 
-		processChart(tempChartDir+"/"+chartDirName, args)
+	var chartMap map[string]interface{}
+	if err := yaml.Unmarshal([]byte(chartYaml), &chartMap); err != nil {
+		return err
+	}
+	chartName, _ := chartMap["name"].(string)
 
-		fmt.Printf("EXECUTION TIME: %.2fs\n", time.Now().Sub(startTime).Seconds())
-		support.PrintCharAcrossScreen("-")
+	//render chart and output to temporary directory
+	if _, stdErr, err := support.ExecuteSingleCommand(append(templateCommand(args), "--output-dir", tempChartDir)); err != nil {
+		return errors.New(stdErr)
+	}
 
-		args[argPos] = tempChartDir + "/" + chartDirName
-		stdOut, stdErr, err := support.ExecuteSingleCommand(append([]string{HelmBin}, args...))
-		support.CheckError(stdErr, err, false)
-		if err == nil {
-			fmt.Println(stdOut)
+	//check if rendered charts are in diff directory.  if they are copy them to temp directory.
+	if chartDirName != chartName {
+		if _, stdErr, err := support.ExecuteSingleCommand([]string{"cp", "-a", tempChartDir + "/" + chartName + "/.", tempChartDir + "/" + chartDirName}); err != nil {
+			return errors.New(stdErr)
 		}
+	}
 
-		//delete temporary chart directory
-		_, stdErr, err = support.ExecuteSingleCommand([]string{"rm", "-rf", tempChartDir})
-		support.CheckError(stdErr, err, true)
+	processChart(tempChartDir+"/"+chartDirName, args)
+
+	fmt.Printf("EXECUTION TIME: %.2fs\n", time.Now().Sub(startTime).Seconds())
+	support.PrintCharAcrossScreen("-")
+
+	args[argPos] = tempChartDir + "/" + chartDirName
+	stdOut, stdErr, err := support.ExecuteSingleCommand(append([]string{HelmBin}, args...))
+	support.CheckError(stdErr, err, false)
+	if err == nil {
+		fmt.Println(stdOut)
+	}
+
+	err = writeReport()
+	support.CheckError("", err, false)
 
+	//delete temporary chart directory
+	if _, stdErr, err := support.ExecuteSingleCommand([]string{"rm", "-rf", tempChartDir}); err != nil {
+		return errors.New(stdErr)
 	}
+
+	return nil
+
 }
 
+//templateFile is a rendered template of a chart, waiting to be optimized.
+type templateFile struct {
+	path      string
+	documents []document
+}
+
+//processChart optimizes every rendered template of a chart and its subcharts.  All containers are resolved at once, before any template is rewritten.
 func processChart(chartPath string, args []string) error {
 
+	var templateFiles []templateFile
+	err := collectChart(chartPath, &templateFiles)
+
+	var documents []document
+	for _, file := range templateFiles {
+		documents = append(documents, file.documents...)
+	}
+	optimizeDocuments(documents)
+
+	for _, file := range templateFiles {
+
+		optimized, changed, err := renderStream(file.documents)
+		support.CheckError("", err, true)
+		if !changed {
+			continue
+		}
+
+		err = ioutil.WriteFile(file.path, []byte(optimized), 0644)
+		support.CheckError("", err, true)
+
+	}
+
+	return err
+
+}
+
+//collectChart parses the rendered templates of a chart and its subcharts.
+func collectChart(chartPath string, templateFiles *[]templateFile) error {
+
 	objs, err := ioutil.ReadDir(chartPath)
 	if err == nil {
 		for _, obj := range objs {
 			if obj.IsDir() {
-				err := processChart(chartPath+"/"+obj.Name(), args)
+				err := collectChart(chartPath+"/"+obj.Name(), templateFiles)
 				if err != nil {
-					fmt.Println(err)
+					fmt.Fprintln(out, err)
 				}
 			}
 		}
@@ -494,223 +694,653 @@ func processChart(chartPath string, args []string) error {
 		return errors.New("'Chart.yaml' not a valid yaml file")
 	}
 
-	//if Chart.yaml has a name field, then print chart name
-	if _, ok := chartStruct["name"]; ok {
-		printData := "CHART: " + chartStruct["name"].(string)
-		fmt.Println(printData + "\n" + strings.Repeat("=", len(printData)))
-	} else {
+	//Chart.yaml must have a name field
+	if _, ok := chartStruct["name"]; !ok {
 		return errors.New("'Chart.yaml' does not contain name field")
 	}
 
-	//if templates directory exists, then process all files in that directory
+	//if templates directory exists, then collect all files in that directory
 	if support.DirExists(chartPath + "/templates") {
-		return processTemplates(chartPath+"/templates", args)
+		collectTemplates(chartPath+"/templates", chartStruct["name"].(string), templateFiles)
+		return nil
 	}
 
-	return errors.New("templates directory doesn't exist for this chart - skipping\n\n")
+	return errors.New("templates directory doesn't exist for chart [" + chartStruct["name"].(string) + "] - skipping\n\n")
 
 }
 
-func processTemplates(templatePath string, args []string) error {
+func collectTemplates(templatePath string, chart string, templateFiles *[]templateFile) {
 
 	templates, err := ioutil.ReadDir(templatePath)
 	if err != nil {
-		return nil
+		return
 	}
 
 	for _, template := range templates {
 
 		if template.IsDir() {
 
-			processTemplates(templatePath+"/"+template.Name(), args)
+			collectTemplates(templatePath+"/"+template.Name(), chart, templateFiles)
 
 		} else {
 
-			manifest, err := ioutil.ReadFile(templatePath + "/" + template.Name())
+			stream, err := ioutil.ReadFile(templatePath + "/" + template.Name())
 			if err != nil {
 				continue
 			}
 
-			objType, objName, objNamespace, containers, manifestMap, err := validateManifest(manifest)
-			if err != nil {
-				continue
+			*templateFiles = append(*templateFiles, templateFile{templatePath + "/" + template.Name(), parseStream(string(stream), chart)})
+
+		}
+
+	}
+
+}
+
+//workload is a k8s object whose containers can be optimized.
+type workload struct {
+	objType      string
+	objName      string
+	objNamespace string
+	kind         string
+	containers   []containerSpec
+}
+
+//containerSpec is a single container of a workload, as it appears in the manifest.
+type containerSpec struct {
+	spec          map[string]interface{}
+	initContainer bool
+}
+
+//name returns the container name, as shown in the console output.
+func (c containerSpec) name() string {
+
+	if c.initContainer {
+		return support.CheckMap(c.spec, "name") + " (initContainer)"
+	}
+
+	return support.CheckMap(c.spec, "name")
+
+}
+
+//containerResult records how the resource spec of a single container was resolved.
+type containerResult struct {
+	chart           string
+	namespace       string
+	objType         string
+	objName         string
+	container       string
+	initContainer   bool
+	approvalSetting string
+	source          string
+	fetchedAt       time.Time
+	cached          bool
+	stale           bool
+	policyNotes     []string
+	mergeNotes      []string
+	repositoryErr   error
+	clusterErr      error
+	original        map[string]map[string]string
+	resources       map[string]map[string]string
+}
+
+//displayName returns the container name, as shown in the console output.
+func (result containerResult) displayName() string {
+
+	if result.initContainer {
+		return result.container + " (initContainer)"
+	}
+
+	return result.container
+
+}
+
+//sources of a resolved resource spec
+const (
+	sourceRepository = "repository"
+	sourceCluster    = "cluster"
+	sourceDefaults   = "defaults"
+	sourceNone       = "none"
+)
+
+//resolveContainer looks up the resource spec of a container, first in the repository, then in the cluster and finally in the template defaults.
+func resolveContainer(chart string, w workload, container containerSpec) containerResult {
+
+	result := containerResult{
+		chart:         chart,
+		namespace:     w.objNamespace,
+		objType:       w.objType,
+		objName:       w.objName,
+		container:     support.CheckMap(container.spec, "name"),
+		initContainer: container.initContainer,
+		original:      resourceMap(container.spec["resources"]),
+	}
+
+	//the spec running in the cluster is looked up at most once, as the baseline of the policy or as the fallback
+	var live map[string]map[string]string
+	var liveErr error
+	liveLooked := false
+
+	//try to get recommendation from the repo, merged into the template within the bounds of the policy
+	insight, err := repositoryInsight(&result, w)
+	if err == nil {
+		merged, mergeNotes := merge.apply(result.original, insight)
+
+		//percent changes are measured against the running spec, so every run can move the resources by up to the policy
+		baseline := result.original
+		if policy.relative() {
+			live, liveErr = clusterSpec(result, w)
+			liveLooked = true
+			if liveErr == nil && len(live) > 0 {
+				baseline = live
 			}
+		}
 
-			fmt.Println("namespace[" + objNamespace + "] objType[" + objType + "] objName[" + objName + "]")
-			var i int = 1
-			for _, container := range containers {
+		var resources map[string]map[string]string
+		if resources, result.policyNotes, err = policy.apply(baseline, merged); err == nil {
+			result.source = sourceRepository
+			result.resources, result.mergeNotes = resources, append(mergeNotes, capRequests(resources)...)
+			return result
+		}
+	}
+	result.repositoryErr = err
 
-				var containerName string
-				if containerName = support.CheckMap(container.(map[string]interface{}), "name"); containerName == "" {
-					continue
-				}
+	//try to get recommendation from k8s
+	if !liveLooked {
+		live, liveErr = clusterSpec(result, w)
+	}
+	insight, err = live, liveErr
+	if err == nil {
+		result.source = sourceCluster
+		result.resources, result.mergeNotes = merge.apply(result.original, insight)
+		return result
+	}
+	result.clusterErr = err
+
+	//try to get defaults from user
+	if len(result.original) > 0 {
+		result.source = sourceDefaults
+		result.resources = result.original
+	} else {
+		result.source = sourceNone
+	}
 
-				fmt.Print(strconv.Itoa(i) + "." + containerName + ": ")
+	return result
 
-				//try to get recommendation from repo
-				insight, approvalSetting, err := getInsight(remoteCluster, objNamespace, objType, objName, containerName)
-				if err != nil {
-					fmt.Println(err)
-				} else {
-					fmt.Print("[" + approvalSetting + "] ")
-					fmt.Println(insight)
-					container.(map[string]interface{})["resources"] = insight
-					i++
-					continue
-				}
+}
 
-				//try to get recommendation from k8s
-				fmt.Print("  Checking Cluster: ")
-				insight, err = extractResourceSpecFromK8S(remoteCluster, objNamespace, objType, objName, containerName)
-				if err != nil {
-					fmt.Println(err)
-				} else {
-					fmt.Println(insight)
-					container.(map[string]interface{})["resources"] = insight
-					i++
-					continue
-				}
+//clusterSpec looks up the resource spec the container is running with in the cluster.
+func clusterSpec(result containerResult, w workload) (map[string]map[string]string, error) {
 
-				//try to get defaults from user
-				fmt.Print("  Checking Defaults: ")
-				var defaultConfig map[string]interface{} = nil
-				if val, ok := container.(map[string]interface{})["resources"].(map[string]interface{}); ok && len(val) > 0 {
-					defaultConfig = container.(map[string]interface{})["resources"].(map[string]interface{})
-					fmt.Println(defaultConfig)
-				} else {
-					fmt.Println("*WARNING* No default config present!")
+	spec, _, err := withTimeout("cluster", func() (map[string]map[string]string, string, error) {
+		spec, err := extractResourceSpecFromK8S(remoteCluster, w.objNamespace, w.kind, w.objName, result.container, result.initContainer)
+		return spec, "", err
+	})
+
+	return spec, err
+
+}
+
+//repositoryInsight returns the insight for a container from the cache, or from the repository when the cached insight is missing or stale.
+func repositoryInsight(result *containerResult, w workload) (map[string]map[string]string, error) {
+
+	cacheKey := insightCacheKey(remoteCluster, w.objNamespace, w.objType, w.objName, result.container)
+	if entry, stale, ok := cachedInsight(cacheKey); ok && (offline || !stale) {
+		result.approvalSetting = entry.ApprovalSetting
+		result.fetchedAt = entry.FetchedAt
+		result.cached = true
+		result.stale = stale
+		return entry.Resources, nil
+	}
+
+	if offline {
+		return nil, errors.New("no cached insight available offline")
+	}
+
+	insight, approvalSetting, err := withTimeout("repository", func() (map[string]map[string]string, string, error) {
+		return getInsight(remoteCluster, w.objNamespace, w.objType, w.objName, result.container)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.approvalSetting = approvalSetting
+	result.fetchedAt = time.Now()
+	cacheInsight(cacheKey, cacheEntry{insight, approvalSetting, result.fetchedAt})
+
+	return insight, nil
+
+}
+
+//printResult writes the resolution of a container to the console.
+func printResult(i int, result containerResult) {
+
+	fmt.Fprint(out, strconv.Itoa(i)+"."+result.displayName()+": ")
+
+	if result.source == sourceRepository {
+		fmt.Fprint(out, "["+result.approvalSetting+"] ")
+		if result.stale {
+			fmt.Fprint(out, "(stale, cached "+fetchedAt(result)+") ")
+		} else if result.cached {
+			fmt.Fprint(out, "(cached "+fetchedAt(result)+") ")
+		}
+		fmt.Fprintln(out, result.resources)
+		for _, note := range result.policyNotes {
+			fmt.Fprintln(out, "  Clamped: "+note)
+		}
+		for _, note := range result.mergeNotes {
+			fmt.Fprintln(out, "  Merged: "+note)
+		}
+		return
+	}
+	fmt.Fprintln(out, result.repositoryErr)
+
+	fmt.Fprint(out, "  Checking Cluster: ")
+	if result.source == sourceCluster {
+		fmt.Fprintln(out, result.resources)
+		for _, note := range result.mergeNotes {
+			fmt.Fprintln(out, "  Merged: "+note)
+		}
+		return
+	}
+	fmt.Fprintln(out, result.clusterErr)
+
+	fmt.Fprint(out, "  Checking Defaults: ")
+	if result.source == sourceDefaults {
+		fmt.Fprintln(out, result.resources)
+	} else {
+		fmt.Fprintln(out, "*WARNING* No default config present!")
+	}
+
+}
+
+//document is a manifest of a stream, along with the workloads found in it.  manifestMap is nil if the manifest holds no workloads.
+type document struct {
+	manifest    string
+	chart       string
+	manifestMap map[string]interface{}
+	workloads   []workload
+}
+
+//optimizeDocuments resolves every container of the documents concurrently, then injects the resource specs and prints the results in document order.
+func optimizeDocuments(documents []document) {
+
+	var lookups []lookup
+	for _, doc := range documents {
+		for _, w := range doc.workloads {
+			for _, container := range w.containers {
+				lookups = append(lookups, lookup{doc.chart, w, container})
+			}
+		}
+	}
+
+	resolved := resolveContainers(lookups)
+
+	chart := ""
+	for _, doc := range documents {
+
+		if doc.chart != "" && doc.chart != chart && len(doc.workloads) > 0 {
+			chart = doc.chart
+			printData := "CHART: " + chart
+			fmt.Fprintln(out, printData+"\n"+strings.Repeat("=", len(printData)))
+		}
+
+		for _, w := range doc.workloads {
+
+			fmt.Fprintln(out, "namespace["+w.objNamespace+"] objType["+w.objType+"] objName["+w.objName+"]")
+			for i, container := range w.containers {
+
+				result := resolved[0]
+				resolved = resolved[1:]
+
+				results = append(results, result)
+				printResult(i+1, result)
+				if result.source == sourceRepository || result.source == sourceCluster {
+					injectResources(container.spec, result.resources)
 				}
 
-				i++
+			}
+			fmt.Fprintln(out, "")
+
+		}
+
+	}
 
+}
+
+//resourceMap converts the resources block of a container into a map of limits/requests.  Valid quantities are returned in canonical form,
+//so values read from templates, the cluster and the repository compare equal, and anything else is kept as written.
+func resourceMap(resources interface{}) map[string]map[string]string {
+
+	resourcesMap, ok := resources.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	parsedResources := map[string]map[string]string{}
+	for section, val := range resourcesMap {
+		if sectionMap, ok := val.(map[string]interface{}); ok {
+			parsedResources[section] = map[string]string{}
+			for resource, val := range sectionMap {
+				parsedResources[section][resource] = fmt.Sprint(val)
+				if canonical, err := quantity.Canonical(resource, fmt.Sprint(val)); err == nil {
+					parsedResources[section][resource] = canonical
+				}
 			}
+		}
+	}
+
+	if len(parsedResources) == 0 {
+		return nil
+	}
 
-			manifestYAMLStr, err := yaml.Marshal(manifestMap)
-			support.CheckError("", err, true)
-			err = ioutil.WriteFile(templatePath+"/"+template.Name(), manifestYAMLStr, 0644)
-			fmt.Println("")
+	return parsedResources
 
+}
+
+//splitManifests splits a multi-document yaml stream into its documents.  Only a '---' or '...' marker at the start of a line ends a document,
+//so the sequence is safe inside document content.
+func splitManifests(stream string) []string {
+
+	var manifests []string
+	var manifest strings.Builder
+
+	flush := func() {
+		if doc := strings.TrimSpace(manifest.String()); doc != "" {
+			manifests = append(manifests, doc)
 		}
+		manifest.Reset()
+	}
 
+	for _, line := range strings.Split(strings.Replace(stream, "\r\n", "\n", -1), "\n") {
+		switch {
+		case line == "---" || line == "...":
+			flush()
+		case strings.HasPrefix(line, "--- ") || strings.HasPrefix(line, "---\t"):
+			flush()
+			manifest.WriteString(line[4:] + "\n")
+		case strings.HasPrefix(line, "... ") || strings.HasPrefix(line, "...\t"):
+			flush()
+		default:
+			manifest.WriteString(line + "\n")
+		}
 	}
+	flush()
 
-	return nil
+	return manifests
 
 }
 
-func validateManifest(manifest []byte) (string, string, string, []interface{}, map[string]interface{}, error) {
+//postRender injects insights into a rendered multi-document stream and writes the result to w.
+func postRender(stream []byte, w io.Writer) error {
+
+	optimized, _, err := optimizeStream(string(stream), "")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, optimized)
+
+	return err
+
+}
+
+//optimizeStream injects insights into every workload of a multi-document stream and returns the rewritten stream.
+//Documents without workloads are passed through untouched.  changed is false if the stream contains no workloads.
+//If chart is empty, the chart of each document is taken from its '# Source:' comment.
+func optimizeStream(stream string, chart string) (string, bool, error) {
+
+	documents := parseStream(stream, chart)
+	optimizeDocuments(documents)
+
+	return renderStream(documents)
+
+}
+
+//parseStream splits a multi-document stream into documents and finds their workloads.
+func parseStream(stream string, chart string) []document {
+
+	var documents []document
+	for _, manifest := range splitManifests(stream) {
+
+		workloads, manifestMap, err := validateManifest([]byte(manifest))
+		if err != nil {
+			documents = append(documents, document{manifest: manifest})
+			continue
+		}
+
+		manifestChart := chart
+		if manifestChart == "" {
+			manifestChart = chartFromSource(manifest)
+		}
+
+		documents = append(documents, document{manifest, manifestChart, manifestMap, workloads})
+
+	}
+
+	return documents
+
+}
+
+//renderStream writes the documents back into a multi-document stream.  changed is false if none of the documents holds workloads.
+func renderStream(documents []document) (string, bool, error) {
+
+	var optimized strings.Builder
+	changed := false
+	for _, doc := range documents {
+
+		if doc.manifestMap == nil {
+			optimized.WriteString("---\n" + doc.manifest + "\n")
+			continue
+		}
+
+		manifestYAMLStr, err := yaml.Marshal(doc.manifestMap)
+		if err != nil {
+			return "", false, err
+		}
+		optimized.WriteString("---\n" + sourceComment(doc.manifest) + strings.TrimSpace(string(manifestYAMLStr)) + "\n")
+		changed = true
+
+	}
+
+	return optimized.String(), changed, nil
+
+}
+
+func validateManifest(manifest []byte) ([]workload, map[string]interface{}, error) {
 
 	var manifestMap map[string]interface{}
 	if err := yaml.Unmarshal(manifest, &manifestMap); err != nil {
-		return "", "", "", nil, nil, errors.New("unable to unmarshal manifest")
+		return nil, nil, errors.New("unable to unmarshal manifest")
+	}
+
+	//lists (e.g. v1/List) carry their objects in items
+	if isList(manifestMap) {
+		items, ok := manifestMap["items"].([]interface{})
+		if !ok {
+			return nil, nil, errors.New("manifest does not contain valid list items")
+		}
+
+		var workloads []workload
+		for _, item := range items {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				if itemWorkload, err := validateObject(itemMap); err == nil {
+					workloads = append(workloads, itemWorkload)
+				}
+			}
+		}
+
+		if len(workloads) == 0 {
+			return nil, nil, errors.New("list does not contain supported objects")
+		}
+
+		return workloads, manifestMap, nil
+	}
+
+	objWorkload, err := validateObject(manifestMap)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return []workload{objWorkload}, manifestMap, nil
+
+}
+
+//isList returns true for a v1/List, or the list of a supported workload kind, e.g. apps/v1 DeploymentList.  Other kinds ending in List,
+//such as a custom AllowList, are objects of their own.
+func isList(manifestMap map[string]interface{}) bool {
+
+	objType := support.CheckMap(manifestMap, "kind")
+	apiVersion := support.CheckMap(manifestMap, "apiVersion")
+	if objType == "List" && apiVersion == "v1" {
+		return true
+	}
+
+	if !strings.HasSuffix(objType, "List") {
+		return false
 	}
+	_, ok := supportedKind(strings.TrimSuffix(objType, "List"), apiVersion)
+
+	return ok
+
+}
+
+func validateObject(manifestMap map[string]interface{}) (workload, error) {
 
 	var objType, objName, objNamespace string
 
 	if objType = support.CheckMap(manifestMap, "kind"); objType == "" {
-		return "", "", "", nil, nil, errors.New("manifest does not contain valid k8s objType")
+		return workload{}, errors.New("manifest does not contain valid k8s objType")
 	}
 
 	if objName = support.CheckMap(manifestMap, "metadata", "name"); objName == "" {
-		return "", "", "", nil, nil, errors.New("manifest does not contain valid k8s objName")
+		return workload{}, errors.New("manifest does not contain valid k8s objName")
 	}
 
 	if objNamespace = support.CheckMap(manifestMap, "metadata", "namespace"); objNamespace == "" {
 		objNamespace = namespace
 	}
 
-	if _, ok := objTypeContainerPath[objType]; !ok {
-		return "", "", "", nil, nil, errors.New("manifest contains objType that's not supported")
+	kind, ok := supportedKind(objType, support.CheckMap(manifestMap, "apiVersion"))
+	if !ok {
+		return workload{}, errors.New("manifest contains objType that's not supported")
 	}
 
 	if val := support.CheckMap(manifestMap, "metadata", "annotations", "helm.sh/hook"); strings.HasPrefix(val, "test") {
-		return "", "", "", nil, nil, errors.New("manifest is for helm test pod")
+		return workload{}, errors.New("manifest is for helm test pod")
+	}
+
+	containerTypes := []string{"containers"}
+	if includeInitContainers {
+		containerTypes = append(containerTypes, "initContainers")
 	}
 
-	var containers []interface{}
-	switch objType {
-	case "Pod":
-		containers = manifestMap["spec"].(map[string]interface{})["containers"].([]interface{})
-	case "CronJob":
-		containers = manifestMap["spec"].(map[string]interface{})["jobTemplate"].(map[string]interface{})["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
-	default:
-		containers = manifestMap["spec"].(map[string]interface{})["template"].(map[string]interface{})["spec"].(map[string]interface{})["containers"].([]interface{})
+	var containers []containerSpec
+	for _, containerType := range containerTypes {
+		val, _ := support.JSONPathValue(manifestMap, containerPath(kind, containerType))
+		list, _ := val.([]interface{})
+		for _, container := range list {
+			if containerMap, ok := container.(map[string]interface{}); ok && support.CheckMap(containerMap, "name") != "" {
+				containers = append(containers, containerSpec{containerMap, containerType == "initContainers"})
+			}
+		}
 	}
 
-	return objType, objName, objNamespace, containers, manifestMap, nil
+	if len(containers) == 0 {
+		return workload{}, errors.New("manifest does not contain any containers")
+	}
+
+	return workload{objType, objName, objNamespace, kind, containers}, nil
 
 }
 
-func extractResourceSpecFromK8S(cluster string, objNamespace string, objType string, objName string, containerName string) (map[string]map[string]string, error) {
+//supportedKind returns the key of objTypeContainerPath that applies to an object.  A kind qualified with its api group (e.g. Service.serving.knative.dev)
+//takes precedence over the bare kind.
+func supportedKind(objType string, apiVersion string) (string, bool) {
 
-	jsonPath := objTypeContainerPath[objType]
+	if pos := strings.Index(apiVersion, "/"); pos > -1 {
+		if _, ok := objTypeContainerPath[objType+"."+apiVersion[:pos]]; ok {
+			return objType + "." + apiVersion[:pos], true
+		}
+	}
 
-	stdOut, stdErr, err := support.ExecuteSingleCommand([]string{KubectlBin, "get", objType, objName, "-o=jsonpath=" + jsonPath, "--cluster=" + cluster, "--namespace=" + objNamespace})
-	if err != nil {
-		return nil, errors.New(stdErr)
+	if _, ok := objTypeContainerPath[objType]; ok {
+		return objType, true
 	}
 
-	var containerDefs []map[string]interface{}
-	json.Unmarshal([]byte(stdOut), &containerDefs)
+	return "", false
 
-	for _, containerDef := range containerDefs {
-		if containerName == containerDef["name"].(string) {
-			if _, ok := containerDef["resources"]; !ok {
-				break
-			}
+}
 
-			jsonStr, err := json.Marshal(containerDef["resources"])
-			if err != nil || string(jsonStr) == "{}" {
-				break
-			}
+//loadWorkloadKinds adds the workload kinds declared in the workload-kinds setting to objTypeContainerPath.
+func loadWorkloadKinds() error {
 
-			var parsedInsight map[string]map[string]string
-			json.Unmarshal([]byte(jsonStr), &parsedInsight)
+	kinds, ok, err := support.SettingMap("workload-kinds")
+	if !ok || err != nil {
+		return err
+	}
 
-			return parsedInsight, nil
+	for kind, jsonPath := range kinds {
+		if !strings.HasPrefix(jsonPath, "{.") || !strings.HasSuffix(jsonPath, ".containers}") {
+			return errors.New("invalid container path [" + jsonPath + "] for workload kind " + kind + " -- expected a jsonpath ending in .containers, e.g. {.spec.template.spec.containers}")
 		}
+		objTypeContainerPath[kind] = jsonPath
 	}
 
-	return nil, errors.New("could not locate resource spec")
+	return nil
 
 }
 
-func interpolateContext() {
+//containerPath returns the jsonpath of the containers (or initContainers) of a kind.
+func containerPath(kind string, containerType string) string {
+	return strings.TrimSuffix(objTypeContainerPath[kind], ".containers}") + "." + containerType + "}"
+}
 
-	//extract working context-info (cluster and namespace)
-	kubeconfig := os.Getenv("KUBECONFIG")
-	kubecontext := os.Getenv("HELM_KUBECONTEXT")
-	namespace = os.Getenv("HELM_NAMESPACE")
+//extractResourceSpecFromK8S looks up the resource spec of a running container.  kind is the key of objTypeContainerPath.
+func extractResourceSpecFromK8S(cluster string, objNamespace string, kind string, objName string, containerName string, initContainer bool) (map[string]map[string]string, error) {
 
-	var stdErr string
-	var err error
-	if kubeconfig != "" {
-		kubeconfig, stdErr, err = support.ExecuteSingleCommand([]string{"cat", kubeconfig})
-	} else {
-		kubeconfig, stdErr, err = support.ExecuteSingleCommand([]string{KubectlBin, "config", "view"})
+	jsonPath := objTypeContainerPath[kind]
+	if initContainer {
+		jsonPath = containerPath(kind, "initContainers")
 	}
-	support.CheckError(stdErr, err, true)
 
-	var kubeconfigYAML map[string]interface{}
-	err = yaml.Unmarshal([]byte(kubeconfig), &kubeconfigYAML)
-	support.CheckError("", err, true)
-
-	//determine current-context
-	if kubecontext == "" {
-		kubecontext = kubeconfigYAML["current-context"].(string)
+	object, err := support.GetObject(cluster, objNamespace, kind, objName)
+	if err != nil {
+		return nil, err
 	}
 
-	//determine local cluster
-	contextList := kubeconfigYAML["contexts"].([]interface{})
-	for _, context := range contextList {
-		if context.(map[string]interface{})["name"] == kubecontext {
-			localCluster = context.(map[string]interface{})["context"].(map[string]interface{})["cluster"].(string)
+	containerDefs, _ := support.JSONPathValue(object, jsonPath)
+	containerList, _ := containerDefs.([]interface{})
+
+	for _, containerDef := range containerList {
+		containerMap, ok := containerDef.(map[string]interface{})
+		if !ok || containerMap["name"] != containerName {
+			continue
+		}
+		if resources := resourceMap(containerMap["resources"]); resources != nil {
+			return resources, nil
 		}
+		break
 	}
 
+	return nil, errors.New("could not locate resource spec")
+
+}
+
+func interpolateContext() {
+
+	//extract working context-info (cluster and namespace)
+	namespace = os.Getenv("HELM_NAMESPACE")
+
+	var err error
+	localCluster, err = support.KubeContextCluster()
+	support.CheckError("", err, true)
+
 	support.LocateConfigNamespace("helm-optimize-plugin")
 
-	if val, ok := support.RetrieveSecrets("helm-optimize-plugin")["remoteCluster"]; ok {
+	if val, ok := support.Setting("remote-cluster"); ok {
+		remoteCluster = val
+	} else if val, ok := support.RetrieveSecrets("helm-optimize-plugin")["remoteCluster"]; ok {
 		remoteCluster = val
 	} else {
 
@@ -721,12 +1351,12 @@ func interpolateContext() {
 			} else if clusterName, ok := support.Config.Get("prometheus_address"); ok {
 				remoteCluster = clusterName
 			} else {
-				fmt.Println("could not resolve remote cluster -- please configure manually using 'helm optimize -c --cluster-mapping'")
-				os.Exit(0)
+				fmt.Println("could not resolve remote cluster -- please configure manually using 'helm optimize -c --cluster-mapping' or --remote-cluster=<cluster>")
+				os.Exit(1)
 			}
 		} else {
-			fmt.Println("could not resolve remote cluster -- please configure manually using 'helm optimize -c --cluster-mapping'")
-			os.Exit(0)
+			fmt.Println("could not resolve remote cluster -- please configure manually using 'helm optimize -c --cluster-mapping' or --remote-cluster=<cluster>")
+			os.Exit(1)
 		}
 
 		support.StoreSecrets("helm-optimize-plugin", map[string]string{"remoteCluster": remoteCluster})
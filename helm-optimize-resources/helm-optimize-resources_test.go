@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+//stubAdapter serves the insights it was given, keyed by container name.
+type stubAdapter struct {
+	insights map[string]map[string]map[string]string
+}
+
+func (a stubAdapter) Name() string {
+	return "Stub"
+}
+
+func (a stubAdapter) Initialize() error {
+	return nil
+}
+
+func (a stubAdapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+
+	if insight, ok := a.insights[containerName]; ok {
+		return insight, "Approved", nil
+	}
+
+	return nil, "", errors.New("no insight for container " + containerName)
+
+}
+
+func (a stubAdapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+	return "Approved", nil
+}
+
+func (a stubAdapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+	return nil
+}
+
+const testManifest = `---
+# Source: web/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: default
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: nginx
+%s`
+
+const testResources = `        resources:
+          limits:
+            cpu: 500m
+            memory: 256Mi
+          requests:
+            cpu: 100m
+            memory: 128Mi
+`
+
+//setupChartFlow points the plugin at a stub adapter, a fake cluster holding the given objects and a runner replaying the given responses.
+func setupChartFlow(t *testing.T, insights map[string]map[string]map[string]string, objects []runtime.Object, responses map[string]support.CommandResponse) *support.RecordingRunner {
+
+	cacheHome, err := ioutil.TempDir("", "helm-optimize-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("HELM_CACHE_HOME", cacheHome)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+	support.SetKube("", &support.KubeClients{Dynamic: dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), objects...), Mapper: mapper})
+
+	runner := support.NewRecordingRunner(responses)
+	t.Cleanup(support.UseRunner(runner))
+
+	adapter = stubAdapter{insights}
+	HelmBin, namespace, remoteCluster = "helm", "default", ""
+	out = ioutil.Discard
+	results = nil
+	insightCache = make(map[string]cacheEntry)
+
+	t.Cleanup(func() {
+		os.RemoveAll(cacheHome)
+		os.Unsetenv("HELM_CACHE_HOME")
+		out = os.Stdout
+	})
+
+	return runner
+
+}
+
+//runningDeployment returns the web deployment as it runs in the cluster, with the given resources on its app container.
+func runningDeployment(resources map[string]interface{}) runtime.Object {
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "default"},
+		"spec": map[string]interface{}{"template": map[string]interface{}{"spec": map[string]interface{}{
+			"containers": []interface{}{map[string]interface{}{"name": "app", "image": "nginx", "resources": resources}},
+		}}},
+	}}
+
+}
+
+func TestDiffChart(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		args          []string
+		command       string
+		template      string
+		insights      map[string]map[string]map[string]string
+		objects       []runtime.Object
+		wantSource    string
+		wantResources map[string]map[string]string
+	}{
+		{
+			name:          "repository",
+			args:          []string{"install", "web", "./web"},
+			command:       "helm template web ./web",
+			template:      testResources,
+			insights:      map[string]map[string]map[string]string{"app": {"limits": {"cpu": "1", "memory": "512Mi"}, "requests": {"cpu": "250m", "memory": "256Mi"}}},
+			wantSource:    sourceRepository,
+			wantResources: map[string]map[string]string{"limits": {"cpu": "1", "memory": "512Mi"}, "requests": {"cpu": "250m", "memory": "256Mi"}},
+		},
+		{
+			name:          "cluster",
+			args:          []string{"upgrade", "--install", "web", "./web", "--history-max", "3", "--namespace", "default"},
+			command:       "helm template web ./web --namespace default",
+			template:      testResources,
+			objects:       []runtime.Object{runningDeployment(map[string]interface{}{"limits": map[string]interface{}{"cpu": "2", "memory": "1Gi"}, "requests": map[string]interface{}{"cpu": "1", "memory": "512Mi"}})},
+			wantSource:    sourceCluster,
+			wantResources: map[string]map[string]string{"limits": {"cpu": "2", "memory": "1Gi"}, "requests": {"cpu": "1", "memory": "512Mi"}},
+		},
+		{
+			name:          "defaults",
+			args:          []string{"install", "web", "./web"},
+			command:       "helm template web ./web",
+			template:      testResources,
+			wantSource:    sourceDefaults,
+			wantResources: map[string]map[string]string{"limits": {"cpu": "500m", "memory": "256Mi"}, "requests": {"cpu": "100m", "memory": "128Mi"}},
+		},
+		{
+			name:       "none",
+			args:       []string{"install", "web", "./web"},
+			command:    "helm template web ./web",
+			wantSource: sourceNone,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			runner := setupChartFlow(t, test.insights, test.objects, map[string]support.CommandResponse{
+				test.command: {StdOut: strings.TrimSpace(strings.Replace(testManifest, "%s", test.template, 1))},
+			})
+
+			var table bytes.Buffer
+			out = &table
+
+			if err := diffChart(test.args); err != nil {
+				t.Fatalf("diffChart() error = %v", err)
+			}
+
+			if commands := runner.Commands(); len(commands) != 1 || strings.Join(commands[0], " ") != test.command {
+				t.Errorf("commands = %v, want [%s]", commands, test.command)
+			}
+			if len(results) != 1 {
+				t.Fatalf("got %d results, want 1", len(results))
+			}
+			if results[0].chart != "web" || results[0].container != "app" {
+				t.Errorf("result for chart [%s] container [%s], want web app", results[0].chart, results[0].container)
+			}
+			if results[0].source != test.wantSource {
+				t.Errorf("source = %s, want %s", results[0].source, test.wantSource)
+			}
+			if test.wantResources != nil && !reflect.DeepEqual(results[0].resources, test.wantResources) {
+				t.Errorf("resources = %v, want %v", results[0].resources, test.wantResources)
+			}
+			if lines := strings.Split(strings.TrimSpace(table.String()), "\n"); len(lines) < 2 || !strings.HasPrefix(lines[0], "NAMESPACE") || !strings.Contains(lines[1], test.wantSource) {
+				t.Errorf("diff table is\n%s\nwant a header and a row for the %s result", table.String(), test.wantSource)
+			}
+
+		})
+	}
+
+}
+
+func TestDiffChartTemplateError(t *testing.T) {
+
+	setupChartFlow(t, nil, nil, map[string]support.CommandResponse{
+		"helm template web ./missing": {StdErr: "Error: path \"./missing\" not found", Err: errors.New("exit status 1")},
+	})
+
+	err := diffChart([]string{"install", "web", "./missing"})
+	if err == nil || err.Error() != "Error: path \"./missing\" not found" {
+		t.Errorf("diffChart() error = %v, want the stderr of helm template", err)
+	}
+
+}
+
+func TestOptimizeStream(t *testing.T) {
+
+	setupChartFlow(t, map[string]map[string]map[string]string{"app": {"limits": {"memory": "512Mi"}, "requests": {"cpu": "250m", "memory": "256Mi"}}}, nil, nil)
+
+	configMap := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: web-config\ndata:\n  key: value"
+	stream := strings.Replace(testManifest, "%s", testResources, 1) + "---\n" + configMap + "\n"
+
+	optimized, changed, err := optimizeStream(stream, "")
+	if err != nil {
+		t.Fatalf("optimizeStream() error = %v", err)
+	}
+	if !changed {
+		t.Error("optimizeStream() reported no change")
+	}
+
+	documents := parseStream(optimized, "")
+	if len(documents) != 2 {
+		t.Fatalf("got %d documents, want 2", len(documents))
+	}
+	if documents[0].chart != "web" || len(documents[0].workloads) != 1 {
+		t.Fatalf("first document is chart [%s] with %d workloads, want web with 1", documents[0].chart, len(documents[0].workloads))
+	}
+
+	want := map[string]map[string]string{"limits": {"cpu": "500m", "memory": "512Mi"}, "requests": {"cpu": "250m", "memory": "256Mi"}}
+	if got := resourceMap(documents[0].workloads[0].containers[0].spec["resources"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("injected resources = %v, want %v", got, want)
+	}
+	if documents[1].manifestMap != nil || documents[1].manifest != configMap {
+		t.Errorf("second document = %q, want the ConfigMap unchanged", documents[1].manifest)
+	}
+
+}
+
+func TestValidateManifestLists(t *testing.T) {
+
+	item := `{"apiVersion": "apps/v1", "kind": "Deployment", "metadata": {"name": "web"}, "spec": {"template": {"spec": {"containers": [{"name": "app"}]}}}}`
+
+	tests := []struct {
+		name          string
+		manifest      string
+		wantWorkloads int
+		wantErr       bool
+	}{
+		{"v1 List", `{"apiVersion": "v1", "kind": "List", "items": [` + item + `, ` + item + `]}`, 2, false},
+		{"typed list", `{"apiVersion": "apps/v1", "kind": "DeploymentList", "items": [` + item + `]}`, 1, false},
+		{"list without workloads", `{"apiVersion": "v1", "kind": "List", "items": [{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"name": "web"}}]}`, 0, true},
+		{"custom kind ending in List", `{"apiVersion": "policy.example.com/v1", "kind": "AllowList", "metadata": {"name": "web"}, "items": [` + item + `]}`, 0, true},
+	}
+
+	for _, test := range tests {
+		workloads, _, err := validateManifest([]byte(test.manifest))
+		if (err != nil) != test.wantErr || len(workloads) != test.wantWorkloads {
+			t.Errorf("%s: validateManifest() = %d workloads, %v, want %d workloads", test.name, len(workloads), err, test.wantWorkloads)
+		}
+	}
+
+}
+
+//chartRunner stands in for helm while a release is optimized.  helm template writes the rendered manifest into the output directory, the
+//release command captures the optimized template it is given, and everything else (cp, rm) runs on the machine.
+type chartRunner struct {
+	rendered  string
+	installed *string
+}
+
+func (r chartRunner) Run(command []string, stdin string) (string, string, error) {
+
+	if command[0] != "helm" {
+		return support.ExecRunner{}.Run(command, stdin)
+	}
+
+	switch command[1] {
+	case "template":
+		outputDir := command[len(command)-1]
+		if err := os.MkdirAll(outputDir+"/web/templates", 0755); err != nil {
+			return "", err.Error(), err
+		}
+		if err := ioutil.WriteFile(outputDir+"/web/templates/deployment.yaml", []byte(r.rendered), 0644); err != nil {
+			return "", err.Error(), err
+		}
+		return "wrote " + outputDir + "/web/templates/deployment.yaml", "", nil
+	case "upgrade":
+		template, err := ioutil.ReadFile(command[3] + "/templates/deployment.yaml")
+		if err != nil {
+			return "", err.Error(), err
+		}
+		*r.installed = string(template)
+		return "Release \"web\" has been upgraded.", "", nil
+	}
+
+	return "", "unexpected command", errors.New("unexpected command [" + strings.Join(command, " ") + "]")
+
+}
+
+const upgradeHelp = `Upgrade a release to a new version of a chart.
+
+Usage:
+  helm upgrade [RELEASE] [CHART] [flags]
+
+Flags:
+  -i, --install   if a release by this name doesn't already exist, run an install
+      --history-max int   limit the maximum number of revisions saved per release
+  -n, --namespace string   namespace scope for this request
+`
+
+func TestOptimizeRelease(t *testing.T) {
+
+	chartDir, err := ioutil.TempDir("", "helm-optimize-chart")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(chartDir)
+	chart := chartDir + "/web"
+	if err := os.MkdirAll(chart+"/templates", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(chart+"/Chart.yaml", []byte("apiVersion: v2\nname: web\nversion: 0.1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"upgrade", "web", chart, "--install", "--history-max", "3", "--namespace", "default"}
+	runner := setupChartFlow(t, map[string]map[string]map[string]string{"app": {"requests": {"cpu": "250m", "memory": "256Mi"}}}, nil, map[string]support.CommandResponse{
+		"helm " + strings.Join(args, " ") + " --dry-run": {StdOut: "Release \"web\" has been upgraded. Happy Helming!"},
+		"helm upgrade -h": {StdOut: upgradeHelp},
+	})
+	var installed string
+	runner.Fallback = chartRunner{strings.Replace(testManifest, "%s", testResources, 1), &installed}
+
+	if err := optimizeRelease(append([]string(nil), args...), time.Now()); err != nil {
+		t.Fatalf("optimizeRelease() error = %v", err)
+	}
+
+	//the release is validated, rendered without the upgrade only flags, then upgraded from the optimized copy of the chart
+	var helmCommands []string
+	for _, command := range runner.Commands() {
+		if command[0] == "helm" {
+			helmCommands = append(helmCommands, strings.Join(command, " "))
+		}
+	}
+	if len(helmCommands) != 4 {
+		t.Fatalf("helm commands = %q, want dry-run, help, template and upgrade", helmCommands)
+	}
+	tempChart := strings.TrimSuffix(strings.Fields(helmCommands[3])[3], "/web")
+	wantCommands := []string{
+		"helm upgrade web " + chart + " --install --history-max 3 --namespace default --dry-run",
+		"helm upgrade -h",
+		"helm template web " + chart + " --namespace default --output-dir " + tempChart,
+		"helm upgrade web " + tempChart + "/web --install --history-max 3 --namespace default",
+	}
+	if !reflect.DeepEqual(helmCommands, wantCommands) {
+		t.Errorf("helm commands =\n%s\nwant\n%s", strings.Join(helmCommands, "\n"), strings.Join(wantCommands, "\n"))
+	}
+
+	documents := parseStream(installed, "web")
+	if len(documents) != 1 || len(documents[0].workloads) != 1 {
+		t.Fatalf("installed template = %q, want the web deployment", installed)
+	}
+	want := map[string]map[string]string{"limits": {"cpu": "500m", "memory": "256Mi"}, "requests": {"cpu": "250m", "memory": "256Mi"}}
+	if got := resourceMap(documents[0].workloads[0].containers[0].spec["resources"]); !reflect.DeepEqual(got, want) {
+		t.Errorf("installed resources = %v, want %v", got, want)
+	}
+
+	if _, err := os.Stat(tempChart); !os.IsNotExist(err) {
+		t.Errorf("temporary chart directory %s was not removed", tempChart)
+	}
+
+}
+
+func TestInterpolateContext(t *testing.T) {
+
+	kubeconfig, err := ioutil.TempFile("", "kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(kubeconfig.Name())
+	kubeconfig.WriteString("apiVersion: v1\nkind: Config\ncurrent-context: dev\ncontexts:\n- name: dev\n  context: {cluster: dev-cluster}\nclusters:\n- name: dev-cluster\n  cluster: {server: https://127.0.0.1:6443}\n")
+	kubeconfig.Close()
+
+	os.Setenv("KUBECONFIG", kubeconfig.Name())
+	os.Setenv("HELM_NAMESPACE", "default")
+	defer os.Unsetenv("KUBECONFIG")
+	defer os.Unsetenv("HELM_NAMESPACE")
+
+	forwarder := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "densify-config", Namespace: "monitoring"},
+		Data:       map[string]string{"config.properties": "# Copyright Densify Inc. D/B/A Densify #  All Rights Reserved.\ncluster_name=forwarded-cluster\n"},
+	}
+	storedSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "helm-optimize-plugin", Namespace: "tools"},
+		Data:       map[string][]byte{"adapter": []byte("Stub"), "remoteCluster": []byte("stored-cluster")},
+	}
+
+	tests := []struct {
+		name       string
+		setting    string
+		objects    []runtime.Object
+		want       string
+		wantStored bool
+	}{
+		{"setting", "prod-cluster", []runtime.Object{storedSecret, forwarder}, "prod-cluster", false},
+		{"stored mapping", "", []runtime.Object{storedSecret, forwarder}, "stored-cluster", false},
+		{"data forwarder", "", []runtime.Object{forwarder}, "forwarded-cluster", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			clientset := fake.NewSimpleClientset(test.objects...)
+			support.SetKube("", &support.KubeClients{Clientset: clientset})
+			support.Config = nil
+			if test.setting != "" {
+				os.Setenv(support.SettingEnvVar("remote-cluster"), test.setting)
+				defer os.Unsetenv(support.SettingEnvVar("remote-cluster"))
+			}
+
+			interpolateContext()
+
+			if localCluster != "dev-cluster" {
+				t.Errorf("localCluster = %s, want dev-cluster", localCluster)
+			}
+			if namespace != "default" {
+				t.Errorf("namespace = %s, want default", namespace)
+			}
+			if remoteCluster != test.want {
+				t.Errorf("remoteCluster = %s, want %s", remoteCluster, test.want)
+			}
+
+			secret, err := clientset.CoreV1().Secrets("default").Get(context.TODO(), "helm-optimize-plugin", metav1.GetOptions{})
+			if stored := err == nil && string(secret.Data["remoteCluster"]) == test.want; stored != test.wantStored {
+				t.Errorf("mapping stored = %v, want %v", stored, test.wantStored)
+			}
+
+		})
+	}
+
+}
@@ -0,0 +1,383 @@
+package kubestore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+	"github.com/ghodss/yaml"
+)
+
+//Name is the name the Kubernetes adapter is registered and stored under.
+const Name = "Kubernetes"
+
+//Kinds the insights are stored in.  ConfigMaps only hold insights when they carry the insightsLabel.
+const (
+	insightKind   = "OptimizationInsight.optimize.densify.com"
+	configMapKind = "ConfigMap"
+	insightsLabel = "optimize.densify.com/insights=true"
+)
+
+//store is crd to keep insights in OptimizationInsight objects, or configmap to keep them in labelled ConfigMaps.
+var store = "crd"
+
+//resourceSpec is the limits/requests of an insight, as they are stored.
+type resourceSpec struct {
+	Limits   map[string]interface{} `json:"limits,omitempty"`
+	Requests map[string]interface{} `json:"requests,omitempty"`
+}
+
+//record is the insight of a single container, along with the object it is stored in.
+//In a ConfigMap, a record is the yaml value of the key <objType>.<objName>.<container>.
+type record struct {
+	Recommended resourceSpec `json:"recommended,omitempty"`
+	Current     resourceSpec `json:"current,omitempty"`
+	Approval    string       `json:"approval,omitempty"`
+	ApprovedBy  string       `json:"approvedBy,omitempty"`
+	ApprovedAt  string       `json:"approvedAt,omitempty"`
+	object      string
+	key         string
+}
+
+//optimizationInsight is the part of an OptimizationInsight object read by the adapter.
+type optimizationInsight struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Spec struct {
+		TargetRef struct {
+			Kind string `json:"kind"`
+			Name string `json:"name"`
+		} `json:"targetRef"`
+		Container   string       `json:"container"`
+		Recommended resourceSpec `json:"recommended"`
+		Current     resourceSpec `json:"current"`
+	} `json:"spec"`
+	Status struct {
+		Approval   string `json:"approval"`
+		ApprovedBy string `json:"approvedBy"`
+		ApprovedAt string `json:"approvedAt"`
+	} `json:"status"`
+}
+
+//namespaceLookup holds the records of a namespace, keyed by objType/objName/container, listed at most once.
+type namespaceLookup struct {
+	once    sync.Once
+	records map[string]*record
+	err     error
+}
+
+//recordCache holds the records of each cluster/namespace, listed once per run.
+var (
+	cacheMu     sync.Mutex
+	recordCache = make(map[string]*namespaceLookup)
+)
+
+type adapter struct{}
+
+func init() {
+	adapters.Register(adapter{})
+	support.RegisterSetting("kube-store")
+}
+
+////////////////////////////////////////////////////////
+////////////////EXTERNAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//Name returns the name of the adapter
+func (adapter) Name() string {
+	return Name
+}
+
+//Initialize will read whether insights are stored in OptimizationInsight objects or ConfigMaps.
+func (adapter) Initialize() error {
+
+	//use the stored store, unless one is supplied as a setting
+	storedSecrets := support.RetrieveSecrets("helm-optimize-plugin")
+	if storedSecrets != nil && storedSecrets["adapter"] == Name {
+		if val, ok := storedSecrets["store"]; ok {
+			store = val
+			if val, ok := support.Setting("kube-store"); ok {
+				store = val
+			}
+			if err := validateStore(); err != nil {
+				return err
+			}
+			if support.Configuring {
+				storeSecrets()
+			}
+			return nil
+		}
+	}
+
+	for {
+		store = support.PromptDefault("kube-store", "Store insights in OptimizationInsight objects or ConfigMaps (crd/configmap) [crd]: ", "crd")
+		if err := validateStore(); err != nil {
+			if !support.CanPrompt("kube-store") {
+				return err
+			}
+			fmt.Println("Invalid entry.  Use crd or configmap.")
+			continue
+		}
+		break
+	}
+
+	if support.Configuring {
+		storeSecrets()
+	}
+
+	return nil
+
+}
+
+//GetInsight gets an insight stored in the cluster based on the keys cluster, namespace, objType, objName and containerName
+func (adapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+
+	rec, err := lookupRecord(cluster, namespace, objType, objName, containerName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	approvalSetting := approvalSetting(rec)
+	spec := rec.Current
+	if approvalSetting == "Approved" {
+		spec = rec.Recommended
+	}
+
+	if len(spec.Limits) == 0 && len(spec.Requests) == 0 {
+		return nil, "", errors.New("invalid resource specs received from repository")
+	}
+
+	insightObj := map[string]map[string]string{}
+	for section, resources := range map[string]map[string]interface{}{"limits": spec.Limits, "requests": spec.Requests} {
+		if len(resources) == 0 {
+			continue
+		}
+		insightObj[section] = map[string]string{}
+		for resource, val := range resources {
+			canonical, err := quantity.Canonical(resource, fmt.Sprint(val))
+			if err != nil {
+				return nil, "", errors.New("invalid resource specs received from repository -- " + err.Error())
+			}
+			insightObj[section][resource] = canonical
+		}
+	}
+
+	return insightObj, approvalSetting, nil
+
+}
+
+//UpdateApprovalSetting will patch the approval into the status of the OptimizationInsight, or the record in the ConfigMap, along with who set it and when.
+//Who set it is the identity the cluster authenticates the patch as, or the kubeconfig user when the cluster cannot report it
+func (adapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+
+	rec, err := lookupRecord(cluster, namespace, objType, objName, containerName)
+	if err != nil {
+		return errors.New("unable to update approval setting")
+	}
+
+	if approved && len(rec.Recommended.Limits) == 0 && len(rec.Recommended.Requests) == 0 {
+		return errors.New("unable to update approval setting -- no recommended resources are stored")
+	}
+
+	updated := rec
+	updated.Approval = "Not Approved"
+	if approved {
+		updated.Approval = "Approved"
+	}
+	updated.ApprovedBy = support.KubeUser(cluster)
+	updated.ApprovedAt = time.Now().UTC().Format(time.RFC3339)
+
+	if store == "configmap" {
+		var value []byte
+		if value, err = yaml.Marshal(updated); err != nil {
+			return errors.New("unable to update approval setting")
+		}
+		patch, _ := json.Marshal(map[string]interface{}{"data": map[string]string{updated.key: string(value)}})
+		_, err = support.PatchObject(cluster, namespace, configMapKind, updated.object, patch)
+	} else {
+		patch, _ := json.Marshal(map[string]interface{}{"status": map[string]string{"approval": updated.Approval, "approvedBy": updated.ApprovedBy, "approvedAt": updated.ApprovedAt}})
+		_, err = support.PatchObject(cluster, namespace, insightKind, updated.object, patch, "status")
+	}
+	if err != nil {
+		return errors.New("unable to update approval setting -- " + err.Error())
+	}
+
+	//replace the listed record, so later lookups see the new approval
+	records, _ := listRecords(cluster, namespace)
+	cacheMu.Lock()
+	records[objType+"/"+objName+"/"+containerName] = &updated
+	cacheMu.Unlock()
+
+	return nil
+
+}
+
+//GetApprovalSetting will acquire the current approval setting
+func (adapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+
+	rec, err := lookupRecord(cluster, namespace, objType, objName, containerName)
+	if err != nil {
+		return "", errors.New("unable to read approval setting")
+	}
+
+	return approvalSetting(rec), nil
+
+}
+
+////////////////////////////////////////////////////////
+///////////////////LOCAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+func validateStore() error {
+
+	if store != "crd" && store != "configmap" {
+		return errors.New("invalid kube-store [" + store + "] -- use crd or configmap")
+	}
+
+	return nil
+
+}
+
+func approvalSetting(rec record) string {
+
+	if rec.Approval == "Approved" {
+		return "Approved"
+	}
+
+	return "Not Approved"
+
+}
+
+//lookupRecord returns a copy of the stored record of a container.
+func lookupRecord(cluster string, namespace string, objType string, objName string, containerName string) (record, error) {
+
+	records, err := listRecords(cluster, namespace)
+	if err != nil {
+		return record{}, err
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+
+	rec, ok := records[objType+"/"+objName+"/"+containerName]
+	if !ok {
+		return record{}, errors.New("could not locate resource spec")
+	}
+	if rec == nil {
+		return record{}, errors.New("more than one insight is stored for " + objType + " [" + namespace + "/" + objName + "] container [" + containerName + "]")
+	}
+
+	return *rec, nil
+
+}
+
+//listRecords lists the records of a namespace, once per run however many containers are looked up concurrently.  A nil record marks a container
+//with more than one insight.
+func listRecords(cluster string, namespace string) (map[string]*record, error) {
+
+	cacheMu.Lock()
+	lookup, ok := recordCache[cluster+"/"+namespace]
+	if !ok {
+		lookup = &namespaceLookup{}
+		recordCache[cluster+"/"+namespace] = lookup
+	}
+	cacheMu.Unlock()
+
+	lookup.once.Do(func() {
+		if store == "configmap" {
+			lookup.records, lookup.err = configMapRecords(cluster, namespace)
+		} else {
+			lookup.records, lookup.err = insightRecords(cluster, namespace)
+		}
+	})
+
+	return lookup.records, lookup.err
+
+}
+
+//insightRecords reads the OptimizationInsight objects of a namespace.
+func insightRecords(cluster string, namespace string) (map[string]*record, error) {
+
+	objects, err := support.ListObjects(cluster, namespace, insightKind, "")
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*record)
+	for _, object := range objects {
+		var insight optimizationInsight
+		if content, err := json.Marshal(object); err != nil || json.Unmarshal(content, &insight) != nil {
+			continue
+		}
+		addRecord(records, insight.Spec.TargetRef.Kind+"/"+insight.Spec.TargetRef.Name+"/"+insight.Spec.Container, &record{
+			Recommended: insight.Spec.Recommended,
+			Current:     insight.Spec.Current,
+			Approval:    insight.Status.Approval,
+			ApprovedBy:  insight.Status.ApprovedBy,
+			ApprovedAt:  insight.Status.ApprovedAt,
+			object:      insight.Metadata.Name,
+		})
+	}
+
+	return records, nil
+
+}
+
+//configMapRecords reads the labelled ConfigMaps of a namespace.  Each key is named <objType>.<objName>.<container>; object names may contain dots,
+//so the kind is everything up to the first dot and the container everything after the last.
+func configMapRecords(cluster string, namespace string) (map[string]*record, error) {
+
+	objects, err := support.ListObjects(cluster, namespace, configMapKind, insightsLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make(map[string]*record)
+	for _, object := range objects {
+		name, _ := support.JSONPathValue(object, "{.metadata.name}")
+		data, _ := object["data"].(map[string]interface{})
+		for key, val := range data {
+			first, last := strings.Index(key, "."), strings.LastIndex(key, ".")
+			value, ok := val.(string)
+			if first < 0 || first == last || !ok {
+				continue
+			}
+			rec := &record{}
+			if err := yaml.Unmarshal([]byte(value), rec); err != nil {
+				continue
+			}
+			rec.object, rec.key = fmt.Sprint(name), key
+			addRecord(records, key[:first]+"/"+key[first+1:last]+"/"+key[last+1:], rec)
+		}
+	}
+
+	return records, nil
+
+}
+
+func addRecord(records map[string]*record, key string, rec *record) {
+
+	if _, dup := records[key]; dup {
+		records[key] = nil
+		return
+	}
+
+	records[key] = rec
+
+}
+
+func storeSecrets() {
+
+	secrets := make(map[string]string)
+	secrets["adapter"] = Name
+	secrets["store"] = store
+	support.StoreSecrets("helm-optimize-plugin", secrets)
+
+}
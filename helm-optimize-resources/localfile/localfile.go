@@ -0,0 +1,343 @@
+package localfile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+	"github.com/ghodss/yaml"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+//Name is the name the local file adapter is registered and stored under.
+const Name = "Local File"
+
+var (
+	insightsFile string
+	insights     map[string]*insightEntry
+)
+
+//insightEntry is a single container insight, keyed by cluster/namespace/objType/objName/container in the insights file.  The limits and requests
+//are the recommendation, and current optionally holds the values used while the recommendation is not approved.
+type insightEntry struct {
+	Approval string                 `json:"approval,omitempty"`
+	Limits   map[string]interface{} `json:"limits,omitempty"`
+	Requests map[string]interface{} `json:"requests,omitempty"`
+	Current  *resourceSpec          `json:"current,omitempty"`
+}
+
+//resourceSpec is a set of limits and requests.
+type resourceSpec struct {
+	Limits   map[string]interface{} `json:"limits,omitempty"`
+	Requests map[string]interface{} `json:"requests,omitempty"`
+}
+
+type adapter struct{}
+
+func init() {
+	adapters.Register(adapter{})
+	support.RegisterSetting("insights-file")
+}
+
+////////////////////////////////////////////////////////
+////////////////EXTERNAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//Name returns the name of the adapter
+func (adapter) Name() string {
+	return Name
+}
+
+//Initialize will load the insights file, prompting for its location if it hasn't been supplied.  The location is not stored in the cluster,
+//as it is local to each machine, e.g. a file committed next to the chart.
+func (adapter) Initialize() error {
+
+	var err error
+	if insightsFile, err = support.Prompt("insights-file", "Enter path to insights file: "); err != nil {
+		return err
+	}
+
+	if err := loadInsights(); err != nil {
+		return err
+	}
+
+	//a file picked for a single run with --adapter does not switch the adapter of every user of the cluster
+	if support.Configuring {
+		storeSecrets()
+	}
+
+	return nil
+
+}
+
+//GetInsight gets an insight from the insights file based on the keys cluster, namespace, objType, objName and containerName
+func (adapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+
+	entry, ok := insights[insightKey(cluster, namespace, objType, objName, containerName)]
+	if !ok {
+		return nil, "", errors.New("could not locate resource spec")
+	}
+
+	//an entry that is not approved serves its current values, or none so the template is left as it is
+	approvalSetting := approvalSetting(entry)
+	spec := resourceSpec{entry.Limits, entry.Requests}
+	if approvalSetting != "Approved" {
+		if entry.Current == nil {
+			return map[string]map[string]string{}, approvalSetting, nil
+		}
+		spec = *entry.Current
+	} else if len(spec.Limits) == 0 && len(spec.Requests) == 0 {
+		return nil, "", errors.New("invalid resource specs received from repository")
+	}
+
+	insightObj, err := canonicalSpec(spec)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return insightObj, approvalSetting, nil
+
+}
+
+//UpdateApprovalSetting will update the approval setting of the entry in the insights file.  Only the approval is rewritten, so the format,
+//comments and order of the file are kept.
+func (adapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+
+	key := insightKey(cluster, namespace, objType, objName, containerName)
+	entry, ok := insights[key]
+	if !ok {
+		return errors.New("unable to update approval setting")
+	}
+
+	approval := "Not Approved"
+	if approved {
+		approval = "Approved"
+	}
+
+	content, err := ioutil.ReadFile(insightsFile)
+	if err != nil {
+		return errors.New("unable to update approval setting -- unable to read insights file [" + insightsFile + "]")
+	}
+
+	updated, err := setApproval(content, key, approval)
+	if err != nil {
+		return errors.New("unable to update approval setting -- " + err.Error())
+	}
+
+	if err := ioutil.WriteFile(insightsFile, updated, 0644); err != nil {
+		return errors.New("unable to update approval setting")
+	}
+
+	entry.Approval = approval
+
+	return nil
+
+}
+
+//GetApprovalSetting will acquire the current approval setting
+func (adapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+
+	entry, ok := insights[insightKey(cluster, namespace, objType, objName, containerName)]
+	if !ok {
+		return "", errors.New("unable to read approval setting")
+	}
+
+	return approvalSetting(entry), nil
+
+}
+
+////////////////////////////////////////////////////////
+///////////////////LOCAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+func insightKey(cluster string, namespace string, objType string, objName string, containerName string) string {
+	return cluster + "/" + namespace + "/" + objType + "/" + objName + "/" + containerName
+}
+
+func approvalSetting(entry *insightEntry) string {
+
+	if entry.Approval == "Approved" {
+		return "Approved"
+	}
+
+	return "Not Approved"
+
+}
+
+func loadInsights() error {
+
+	content, err := ioutil.ReadFile(insightsFile)
+	if err != nil {
+		return errors.New("unable to read insights file [" + insightsFile + "]")
+	}
+
+	var parsedInsights map[string]*insightEntry
+	if err := yaml.Unmarshal(content, &parsedInsights); err != nil {
+		return errors.New("insights file [" + insightsFile + "] is not valid yaml or json")
+	}
+
+	for key, entry := range parsedInsights {
+		if entry == nil {
+			delete(parsedInsights, key)
+		}
+	}
+
+	insights = parsedInsights
+
+	return nil
+
+}
+
+//canonicalSpec validates the limits and requests of an entry and returns them in canonical form.
+func canonicalSpec(spec resourceSpec) (map[string]map[string]string, error) {
+
+	insightObj := map[string]map[string]string{}
+	for section, resources := range map[string]map[string]interface{}{"limits": spec.Limits, "requests": spec.Requests} {
+		if len(resources) == 0 {
+			continue
+		}
+		insightObj[section] = map[string]string{}
+		for resource, val := range resources {
+			if val == nil {
+				return nil, errors.New("invalid resource specs received from repository")
+			}
+			canonical, err := quantity.Canonical(resource, fmt.Sprint(val))
+			if err != nil {
+				return nil, errors.New("invalid resource specs received from repository -- " + err.Error())
+			}
+			insightObj[section][resource] = canonical
+		}
+	}
+
+	return insightObj, nil
+
+}
+
+//setApproval rewrites the approval of an entry in the content of an insights file, adding it ahead of the first field of the entry when it
+//isn't set.  The rest of the content is left untouched.
+func setApproval(content []byte, key string, approval string) ([]byte, error) {
+
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(content, &doc); err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yamlv3.MappingNode {
+		return nil, errors.New("insights file [" + insightsFile + "] is not valid yaml or json")
+	}
+
+	entries := doc.Content[0].Content
+	for i := 0; i+1 < len(entries); i += 2 {
+		entry := entries[i+1]
+		if entries[i].Value != key || entry.Kind != yamlv3.MappingNode || len(entry.Content) == 0 {
+			continue
+		}
+
+		for j := 0; j+1 < len(entry.Content); j += 2 {
+			value := entry.Content[j+1]
+			if entry.Content[j].Value != "approval" || value.Kind != yamlv3.ScalarNode || value.Value == "" {
+				continue
+			}
+			start := offset(content, value.Line, value.Column)
+			end := scalarEnd(content, start, value)
+			return splice(content, start, end, quote(approval, value.Style)), nil
+		}
+
+		first := entry.Content[0]
+		start := offset(content, first.Line, first.Column)
+		separator := "\n" + strings.Repeat(" ", first.Column-1)
+		if entry.Style&yamlv3.FlowStyle != 0 {
+			if first.Line == entry.Line {
+				separator = " "
+			}
+			return splice(content, start, start, strconv.Quote("approval")+": "+strconv.Quote(approval)+","+separator), nil
+		}
+		return splice(content, start, start, "approval: "+quote(approval, first.Style)+separator), nil
+	}
+
+	return nil, errors.New("entry [" + key + "] not found in insights file [" + insightsFile + "]")
+
+}
+
+//offset converts the 1-based line and column of a node to the offset of its first byte.
+func offset(content []byte, line int, column int) int {
+
+	pos := 0
+	for l := 1; l < line; l++ {
+		next := bytes.IndexByte(content[pos:], '\n')
+		if next < 0 {
+			return len(content)
+		}
+		pos += next + 1
+	}
+
+	for c := 1; c < column && pos < len(content); c++ {
+		_, size := utf8.DecodeRune(content[pos:])
+		pos += size
+	}
+
+	return pos
+
+}
+
+//scalarEnd returns the offset just past a scalar, including its closing quote.
+func scalarEnd(content []byte, start int, node *yamlv3.Node) int {
+
+	switch {
+	case node.Style&yamlv3.DoubleQuotedStyle != 0:
+		for i := start + 1; i < len(content); i++ {
+			if content[i] == '\\' {
+				i++
+			} else if content[i] == '"' {
+				return i + 1
+			}
+		}
+	case node.Style&yamlv3.SingleQuotedStyle != 0:
+		for i := start + 1; i < len(content); i++ {
+			if content[i] == '\'' && i+1 < len(content) && content[i+1] == '\'' {
+				i++
+			} else if content[i] == '\'' {
+				return i + 1
+			}
+		}
+	default:
+		return start + len(node.Value)
+	}
+
+	return len(content)
+
+}
+
+//quote writes a value in the style of the scalar it replaces.
+func quote(value string, style yamlv3.Style) string {
+
+	switch {
+	case style&yamlv3.DoubleQuotedStyle != 0:
+		return strconv.Quote(value)
+	case style&yamlv3.SingleQuotedStyle != 0:
+		return "'" + value + "'"
+	}
+
+	return value
+
+}
+
+func splice(content []byte, start int, end int, value string) []byte {
+
+	spliced := append([]byte(nil), content[:start]...)
+	spliced = append(spliced, value...)
+
+	return append(spliced, content[end:]...)
+
+}
+
+func storeSecrets() {
+
+	secrets := make(map[string]string)
+	secrets["adapter"] = Name
+	support.StoreSecrets("helm-optimize-plugin", secrets)
+
+}
@@ -0,0 +1,197 @@
+package localfile
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const yamlInsights = `# insights exported from the capacity review
+prod/shop/Deployment/web/app:
+  approval: 'Not Approved'   # pending review
+  requests:
+    cpu: 250m
+    memory: 256Mi
+  limits: {cpu: 1, memory: 512Mi}
+prod/shop/Deployment/web/sidecar:
+  requests:
+    cpu: 0.05
+    memory: 64Mi
+  current:
+    requests: {cpu: 0.1, memory: 128Mi}
+prod/shop/StatefulSet/db/db:
+  approval: Approved
+  requests:
+    cpu: 2
+    memory: 4Gi
+prod/shop/Deployment/api/api:
+  approval: Approved
+  requests:
+    cpu: lots
+`
+
+//writeInsights writes the insights file into a temporary directory and loads it.
+func writeInsights(t *testing.T, name string, content string) {
+
+	dir, err := ioutil.TempDir("", "helm-optimize-insights")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	insightsFile = filepath.Join(dir, name)
+	if err := ioutil.WriteFile(insightsFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadInsights(); err != nil {
+		t.Fatalf("loadInsights() error = %v", err)
+	}
+
+}
+
+func TestGetInsight(t *testing.T) {
+
+	writeInsights(t, "insights.yaml", yamlInsights)
+
+	tests := []struct {
+		objType      string
+		objName      string
+		container    string
+		want         map[string]map[string]string
+		wantApproval string
+		wantErr      string
+	}{
+		{"StatefulSet", "db", "db", map[string]map[string]string{"requests": {"cpu": "2", "memory": "4Gi"}}, "Approved", ""},
+		{"Deployment", "web", "app", map[string]map[string]string{}, "Not Approved", ""},
+		{"Deployment", "web", "sidecar", map[string]map[string]string{"requests": {"cpu": "100m", "memory": "128Mi"}}, "Not Approved", ""},
+		{"Deployment", "api", "api", nil, "", "invalid resource specs received from repository -- invalid quantity [lots]"},
+		{"Deployment", "web", "missing", nil, "", "could not locate resource spec"},
+	}
+
+	for _, test := range tests {
+		insight, approval, err := adapter{}.GetInsight("prod", "shop", test.objType, test.objName, test.container)
+		if test.wantErr != "" {
+			if err == nil || err.Error() != test.wantErr {
+				t.Errorf("GetInsight(%s/%s/%s) error = %v, want %s", test.objType, test.objName, test.container, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil || approval != test.wantApproval || !reflect.DeepEqual(insight, test.want) {
+			t.Errorf("GetInsight(%s/%s/%s) = %v, %s, %v, want %v, %s", test.objType, test.objName, test.container, insight, approval, err, test.want, test.wantApproval)
+		}
+	}
+
+}
+
+func TestUpdateApprovalSetting(t *testing.T) {
+
+	jsonInsights := `{"prod/shop/Deployment/web/app": {"requests": {"cpu": "250m", "memory": "256Mi"}}}`
+
+	tests := []struct {
+		name      string
+		file      string
+		content   string
+		objType   string
+		objName   string
+		container string
+		approved  bool
+		old       string
+		new       string
+	}{
+		{
+			name:      "quoted yaml approval keeps its quotes and comment",
+			file:      "insights.yaml",
+			content:   yamlInsights,
+			objType:   "Deployment",
+			objName:   "web",
+			container: "app",
+			approved:  true,
+			old:       "approval: 'Not Approved'   # pending review",
+			new:       "approval: 'Approved'   # pending review",
+		},
+		{
+			name:      "missing yaml approval is added ahead of the first field",
+			file:      "insights.yaml",
+			content:   yamlInsights,
+			objType:   "Deployment",
+			objName:   "web",
+			container: "sidecar",
+			approved:  true,
+			old:       "web/sidecar:\n  requests:",
+			new:       "web/sidecar:\n  approval: Approved\n  requests:",
+		},
+		{
+			name:      "plain yaml approval",
+			file:      "insights.yaml",
+			content:   yamlInsights,
+			objType:   "StatefulSet",
+			objName:   "db",
+			container: "db",
+			approved:  false,
+			old:       "db/db:\n  approval: Approved",
+			new:       "db/db:\n  approval: Not Approved",
+		},
+		{
+			name:      "json stays json",
+			file:      "insights.json",
+			content:   jsonInsights,
+			objType:   "Deployment",
+			objName:   "web",
+			container: "app",
+			approved:  true,
+			old:       `{"requests"`,
+			new:       `{"approval": "Approved", "requests"`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			writeInsights(t, test.file, test.content)
+
+			if err := (adapter{}).UpdateApprovalSetting(test.approved, "prod", "shop", test.objType, test.objName, test.container); err != nil {
+				t.Fatalf("UpdateApprovalSetting() error = %v", err)
+			}
+
+			content, err := ioutil.ReadFile(insightsFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.Replace(test.content, test.old, test.new, 1); string(content) != want {
+				t.Errorf("insights file is\n%s\nwant\n%s", content, want)
+			}
+
+			//the rewritten file loads with the new approval
+			want := "Not Approved"
+			if test.approved {
+				want = "Approved"
+			}
+			if err := loadInsights(); err != nil {
+				t.Fatalf("loadInsights() error = %v", err)
+			}
+			if approval, err := (adapter{}).GetApprovalSetting("prod", "shop", test.objType, test.objName, test.container); err != nil || approval != want {
+				t.Errorf("GetApprovalSetting() = %s, %v, want %s", approval, err, want)
+			}
+
+		})
+	}
+
+}
+
+func TestUpdateApprovalSettingMissingEntry(t *testing.T) {
+
+	writeInsights(t, "insights.yaml", yamlInsights)
+
+	if err := (adapter{}).UpdateApprovalSetting(true, "prod", "shop", "Deployment", "web", "missing"); err == nil {
+		t.Error("UpdateApprovalSetting() of a missing entry succeeded")
+	}
+
+	content, err := ioutil.ReadFile(insightsFile)
+	if err != nil || string(content) != yamlInsights {
+		t.Errorf("insights file changed after a failed update:\n%s", content)
+	}
+
+}
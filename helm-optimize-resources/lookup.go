@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//concurrency is the number of containers resolved at the same time.
+var concurrency = 8
+
+//lookupTimeout bounds each repository and cluster lookup.  Zero disables the timeout.
+var lookupTimeout = 30 * time.Second
+
+func init() {
+	support.RegisterSetting("concurrency")
+	support.RegisterSetting("lookup-timeout")
+}
+
+//lookup is a container whose resources have to be resolved.
+type lookup struct {
+	chart     string
+	w         workload
+	container containerSpec
+}
+
+//loadLookupSettings reads the concurrency and lookup-timeout settings.
+func loadLookupSettings() error {
+
+	if val, ok := support.Setting("concurrency"); ok {
+		workers, err := strconv.Atoi(val)
+		if err != nil || workers < 1 {
+			return errors.New("invalid value [" + val + "] for setting concurrency -- use a number greater than 0")
+		}
+		concurrency = workers
+	}
+
+	if val, ok := support.Setting("lookup-timeout"); ok {
+		timeout, err := time.ParseDuration(val)
+		if err != nil || timeout < 0 {
+			return errors.New("invalid value [" + val + "] for setting lookup-timeout -- use a duration, e.g. 30s")
+		}
+		lookupTimeout = timeout
+	}
+
+	return nil
+
+}
+
+//resolveContainers resolves the containers with a pool of workers bounded by the concurrency setting.
+//The results are returned in the order of the lookups, however long each of them takes.
+func resolveContainers(lookups []lookup) []containerResult {
+
+	resolved := make([]containerResult, len(lookups))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(lookups); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				resolved[j] = resolveContainer(lookups[j].chart, lookups[j].w, lookups[j].container)
+			}
+		}()
+	}
+
+	for j := range lookups {
+		jobs <- j
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := saveInsightCache(); err != nil {
+		fmt.Fprintln(out, err)
+	}
+
+	return resolved
+
+}
+
+//withTimeout runs a lookup, giving up on it once the lookup-timeout has passed.  The abandoned lookup is left to finish in the background.
+func withTimeout(source string, fn func() (map[string]map[string]string, string, error)) (map[string]map[string]string, string, error) {
+
+	if lookupTimeout == 0 {
+		return fn()
+	}
+
+	type lookupResult struct {
+		resources       map[string]map[string]string
+		approvalSetting string
+		err             error
+	}
+
+	done := make(chan lookupResult, 1)
+	go func() {
+		resources, approvalSetting, err := fn()
+		done <- lookupResult{resources, approvalSetting, err}
+	}()
+
+	timer := time.NewTimer(lookupTimeout)
+	defer timer.Stop()
+
+	select {
+	case result := <-done:
+		return result.resources, result.approvalSetting, result.err
+	case <-timer.C:
+		return nil, "", errors.New(source + " lookup timed out after " + lookupTimeout.String())
+	}
+
+}
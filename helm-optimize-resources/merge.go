@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//mergeOptions control how an insight is merged into the resources set by the template.
+type mergeOptions struct {
+	keepTemplateLimits bool
+	dropCPULimits      bool
+	requestsOnly       bool
+}
+
+//merge overrides the template resource by resource, unless merge settings are supplied.
+var merge mergeOptions
+
+func init() {
+	support.RegisterBoolSetting("keep-template-limits")
+	support.RegisterBoolSetting("drop-cpu-limits")
+	support.RegisterBoolSetting("requests-only")
+}
+
+//loadMergeSettings reads the merge settings.
+func loadMergeSettings() error {
+
+	var err error
+	if merge.keepTemplateLimits, err = support.BoolSetting("keep-template-limits"); err != nil {
+		return err
+	}
+
+	if merge.dropCPULimits, err = support.BoolSetting("drop-cpu-limits"); err != nil {
+		return err
+	}
+
+	if merge.requestsOnly, err = support.BoolSetting("requests-only"); err != nil {
+		return err
+	}
+
+	if merge.requestsOnly && merge.keepTemplateLimits {
+		return errors.New("settings requests-only and keep-template-limits can't be used together")
+	}
+
+	return nil
+
+}
+
+//apply merges an insight into the resources of the template.  Each resource of the insight overrides the same resource of the template,
+//and resources the insight doesn't mention are kept, e.g. an ephemeral-storage limit set by the chart.
+//A request left above its limit by the merge is lowered to the limit, and the reason is returned.
+func (m mergeOptions) apply(original map[string]map[string]string, insight map[string]map[string]string) (map[string]map[string]string, []string) {
+
+	merged := map[string]map[string]string{"limits": {}, "requests": {}}
+	for section, values := range original {
+		if merged[section] == nil {
+			merged[section] = map[string]string{}
+		}
+		for resource, val := range values {
+			merged[section][resource] = val
+		}
+	}
+
+	for section, values := range insight {
+		if merged[section] == nil {
+			merged[section] = map[string]string{}
+		}
+		for resource, val := range values {
+			if section == "limits" && m.requestsOnly {
+				continue
+			}
+			if _, ok := original["limits"][resource]; ok && section == "limits" && m.keepTemplateLimits {
+				continue
+			}
+			merged[section][resource] = val
+		}
+	}
+
+	if m.dropCPULimits {
+		delete(merged["limits"], "cpu")
+	}
+
+	notes := capRequests(merged)
+
+	for section, values := range merged {
+		if len(values) == 0 {
+			delete(merged, section)
+		}
+	}
+
+	return merged, notes
+
+}
+
+//capRequests lowers each request that is above its limit to the limit, and returns the reason for each change.
+func capRequests(resources map[string]map[string]string) []string {
+
+	var notes []string
+	for _, resource := range sortedKeys(resources["requests"]) {
+		limit, ok := resources["limits"][resource]
+		if !ok {
+			continue
+		}
+		if cmp, err := quantity.Compare(resources["requests"][resource], limit); err == nil && cmp > 0 {
+			notes = append(notes, "requests."+resource+" "+resources["requests"][resource]+" is above limits."+resource+" "+limit+", lowered to the limit")
+			resources["requests"][resource] = limit
+		}
+	}
+
+	return notes
+
+}
+
+//injectResources writes the merged requests and limits into the resources block of a container.  Other fields of the block, such as claims,
+//are left as the template set them.
+func injectResources(container map[string]interface{}, resources map[string]map[string]string) {
+
+	block, ok := container["resources"].(map[string]interface{})
+	if !ok {
+		block = map[string]interface{}{}
+	}
+
+	for _, section := range []string{"limits", "requests"} {
+		if len(resources[section]) > 0 {
+			block[section] = resources[section]
+		} else {
+			delete(block, section)
+		}
+	}
+
+	container["resources"] = block
+
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//resourcePolicy bounds how far an insight from the repository may move the resources of a container.
+type resourcePolicy struct {
+	maxDecrease       float64
+	maxIncrease       float64
+	floors            map[string]float64
+	ceilings          map[string]float64
+	limitRequestRatio float64
+	reject            bool
+}
+
+//policy is unbounded unless policy settings are supplied.
+var policy = resourcePolicy{
+	maxDecrease: 100,
+	maxIncrease: math.Inf(1),
+	floors:      map[string]float64{},
+	ceilings:    map[string]float64{},
+}
+
+func init() {
+	support.RegisterSetting("max-decrease")
+	support.RegisterSetting("max-increase")
+	support.RegisterSetting("min-cpu")
+	support.RegisterSetting("max-cpu")
+	support.RegisterSetting("min-memory")
+	support.RegisterSetting("max-memory")
+	support.RegisterSetting("limit-request-ratio")
+	support.RegisterSetting("policy-action")
+}
+
+//loadPolicySettings reads the policy settings.
+func loadPolicySettings() error {
+
+	if val, ok := support.Setting("max-decrease"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(val, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return errors.New("invalid value [" + val + "] for setting max-decrease -- use a percentage between 0 and 100")
+		}
+		policy.maxDecrease = percent
+	}
+
+	if val, ok := support.Setting("max-increase"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(val, "%"), 64)
+		if err != nil || percent < 0 {
+			return errors.New("invalid value [" + val + "] for setting max-increase -- use a percentage of 0 or more")
+		}
+		policy.maxIncrease = percent
+	}
+
+	for _, resource := range []string{"cpu", "memory"} {
+		for _, bound := range []struct {
+			key    string
+			values map[string]float64
+		}{{"min-" + resource, policy.floors}, {"max-" + resource, policy.ceilings}} {
+			if val, ok := support.Setting(bound.key); ok {
+				value, err := quantity.Value(val)
+				if err != nil || value <= 0 {
+					return errors.New("invalid value [" + val + "] for setting " + bound.key + " -- use a resource quantity, e.g. 100m or 128Mi")
+				}
+				bound.values[resource] = value
+			}
+		}
+		if floor, ok := policy.floors[resource]; ok && floor > policy.ceilings[resource] && policy.ceilings[resource] > 0 {
+			return errors.New("setting min-" + resource + " is greater than max-" + resource)
+		}
+	}
+
+	if val, ok := support.Setting("limit-request-ratio"); ok {
+		ratio, err := strconv.ParseFloat(val, 64)
+		if err != nil || ratio < 1 {
+			return errors.New("invalid value [" + val + "] for setting limit-request-ratio -- use a number of 1 or more")
+		}
+		policy.limitRequestRatio = ratio
+	}
+
+	if val, ok := support.Setting("policy-action"); ok {
+		if val != "clamp" && val != "reject" {
+			return errors.New("invalid value [" + val + "] for setting policy-action -- use clamp or reject")
+		}
+		policy.reject = val == "reject"
+	}
+
+	return nil
+
+}
+
+//relative returns true when the policy bounds the change from the baseline, not only the values themselves.
+func (p resourcePolicy) relative() bool {
+	return p.maxDecrease < 100 || !math.IsInf(p.maxIncrease, 1)
+}
+
+//apply checks the resources an insight was merged into against the policy.  Percent changes are measured against the baseline.  Values outside
+//the policy are clamped, and the reason for each change is returned.  If the policy action is reject, resources that break the policy are
+//returned as an error instead.
+func (p resourcePolicy) apply(baseline map[string]map[string]string, insight map[string]map[string]string) (map[string]map[string]string, []string, error) {
+
+	var reasons []string
+	values := map[string]map[string]float64{}
+	for _, section := range sortedKeys(insight) {
+		values[section] = map[string]float64{}
+		for _, resource := range sortedKeys(insight[section]) {
+
+			value, err := quantity.Value(insight[section][resource])
+			if err != nil {
+				continue
+			}
+			clamped := value
+
+			//relative to the baseline
+			if before, err := quantity.Value(baseline[section][resource]); err == nil && before > 0 {
+				if lower := before * (1 - p.maxDecrease/100); clamped < lower {
+					clamped = lower
+					reasons = append(reasons, section+"."+resource+" "+insight[section][resource]+" is more than "+formatPercent(p.maxDecrease)+" below "+baseline[section][resource]+" (max-decrease)")
+				}
+				if upper := before * (1 + p.maxIncrease/100); clamped > upper {
+					clamped = upper
+					reasons = append(reasons, section+"."+resource+" "+insight[section][resource]+" is more than "+formatPercent(p.maxIncrease)+" above "+baseline[section][resource]+" (max-increase)")
+				}
+			}
+
+			//absolute bounds
+			if floor, ok := p.floors[resource]; ok && clamped < floor {
+				clamped = floor
+				reasons = append(reasons, section+"."+resource+" "+insight[section][resource]+" is below "+quantity.Format(resource, floor)+" (min-"+resource+")")
+			}
+			if ceiling, ok := p.ceilings[resource]; ok && clamped > ceiling {
+				clamped = ceiling
+				reasons = append(reasons, section+"."+resource+" "+insight[section][resource]+" is above "+quantity.Format(resource, ceiling)+" (max-"+resource+")")
+			}
+
+			if clamped != value {
+				values[section][resource] = clamped
+			}
+
+		}
+	}
+
+	//limit-to-request ratio, fixed by raising the request so the container keeps the limit it was given.  When the bounds of the request
+	//don't allow it to be raised that far, the request is raised to its bound and the limit is lowered to meet the ratio instead.
+	if p.limitRequestRatio > 0 {
+		ratio := strconv.FormatFloat(p.limitRequestRatio, 'f', -1, 64)
+		for _, resource := range sortedKeys(insight["limits"]) {
+			limit, limitErr := policyValue(insight, values, "limits", resource)
+			request, requestErr := policyValue(insight, values, "requests", resource)
+			if limitErr != nil || requestErr != nil || request <= 0 || limit/request <= p.limitRequestRatio {
+				continue
+			}
+			reason := resource + " limit is more than " + ratio + " times the request (limit-request-ratio)"
+
+			_, requestUpper := p.bounds(baseline, "requests", resource)
+			if raised := limit / p.limitRequestRatio; raised <= requestUpper {
+				values["requests"][resource] = raised
+				reasons = append(reasons, reason)
+				continue
+			}
+
+			limitLower, _ := p.bounds(baseline, "limits", resource)
+			if lowered := requestUpper * p.limitRequestRatio; lowered >= limitLower {
+				values["requests"][resource] = requestUpper
+				values["limits"][resource] = lowered
+				reasons = append(reasons, reason+", and the request can't be raised above "+quantity.Format(resource, requestUpper)+", so the limit is lowered to "+quantity.Format(resource, lowered))
+				continue
+			}
+
+			reasons = append(reasons, reason+", and can't be met within the other bounds of the policy")
+		}
+	}
+
+	if len(reasons) == 0 {
+		return insight, nil, nil
+	}
+
+	if p.reject {
+		return nil, reasons, errors.New("rejected by policy: " + strings.Join(reasons, "; "))
+	}
+
+	clamped := map[string]map[string]string{}
+	for section, resources := range insight {
+		clamped[section] = map[string]string{}
+		for resource, val := range resources {
+			clamped[section][resource] = val
+			if value, ok := values[section][resource]; ok {
+				clamped[section][resource] = quantity.Format(resource, value)
+			}
+		}
+	}
+
+	return clamped, reasons, nil
+
+}
+
+//bounds returns the lowest and highest value the policy allows for a resource of a section, relative to the baseline and absolute.
+func (p resourcePolicy) bounds(baseline map[string]map[string]string, section string, resource string) (float64, float64) {
+
+	lower, upper := 0.0, math.Inf(1)
+	if before, err := quantity.Value(baseline[section][resource]); err == nil && before > 0 {
+		lower, upper = before*(1-p.maxDecrease/100), before*(1+p.maxIncrease/100)
+	}
+
+	if floor, ok := p.floors[resource]; ok {
+		lower = math.Max(lower, floor)
+	}
+	if ceiling, ok := p.ceilings[resource]; ok {
+		upper = math.Min(upper, ceiling)
+	}
+
+	return lower, upper
+
+}
+
+//policyValue returns a resource of an insight, after any clamping.
+func policyValue(insight map[string]map[string]string, values map[string]map[string]float64, section string, resource string) (float64, error) {
+
+	if value, ok := values[section][resource]; ok {
+		return value, nil
+	}
+
+	return quantity.Value(insight[section][resource])
+
+}
+
+func formatPercent(percent float64) string {
+	return strconv.FormatFloat(percent, 'f', -1, 64) + "%"
+}
+
+//sortedKeys returns the keys of a map in order, so policy reasons are always reported in the same order.
+func sortedKeys(m interface{}) []string {
+
+	var keys []string
+	switch typed := m.(type) {
+	case map[string]map[string]string:
+		for key := range typed {
+			keys = append(keys, key)
+		}
+	case map[string]string:
+		for key := range typed {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	return keys
+
+}
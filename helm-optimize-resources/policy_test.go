@@ -0,0 +1,72 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPolicyLimitRequestRatio(t *testing.T) {
+
+	resources := func(limit string, request string) map[string]map[string]string {
+		return map[string]map[string]string{"limits": {"cpu": limit}, "requests": {"cpu": request}}
+	}
+
+	tests := []struct {
+		name       string
+		policy     resourcePolicy
+		baseline   map[string]map[string]string
+		insight    map[string]map[string]string
+		want       map[string]map[string]string
+		wantReason string
+	}{
+		{
+			name:       "request raised",
+			policy:     resourcePolicy{maxDecrease: 100, maxIncrease: math.Inf(1), limitRequestRatio: 4},
+			insight:    resources("4", "100m"),
+			want:       resources("4", "1"),
+			wantReason: "cpu limit is more than 4 times the request (limit-request-ratio)",
+		},
+		{
+			name:       "request held by max-increase lowers the limit",
+			policy:     resourcePolicy{maxDecrease: 100, maxIncrease: 100, limitRequestRatio: 4},
+			baseline:   resources("4", "100m"),
+			insight:    resources("4", "100m"),
+			want:       resources("800m", "200m"),
+			wantReason: "the request can't be raised above 200m, so the limit is lowered to 800m",
+		},
+		{
+			name:       "limit held by max-decrease",
+			policy:     resourcePolicy{maxDecrease: 10, maxIncrease: 100, limitRequestRatio: 4},
+			baseline:   resources("4", "100m"),
+			insight:    resources("4", "100m"),
+			want:       resources("4", "100m"),
+			wantReason: "can't be met within the other bounds of the policy",
+		},
+		{
+			name:    "within the ratio",
+			policy:  resourcePolicy{maxDecrease: 100, maxIncrease: math.Inf(1), limitRequestRatio: 4},
+			insight: resources("1", "250m"),
+			want:    resources("1", "250m"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			got, reasons, err := test.policy.apply(test.baseline, test.insight)
+			if err != nil {
+				t.Fatalf("apply() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("apply() = %v, want %v", got, test.want)
+			}
+			if test.wantReason == "" && len(reasons) > 0 || test.wantReason != "" && (len(reasons) != 1 || !strings.Contains(reasons[0], test.wantReason)) {
+				t.Errorf("reasons = %q, want one containing %q", reasons, test.wantReason)
+			}
+
+		})
+	}
+
+}
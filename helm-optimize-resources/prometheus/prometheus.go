@@ -0,0 +1,300 @@
+package prometheus
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//Name is the name the Prometheus adapter is registered and stored under.
+const Name = "Prometheus"
+
+var (
+	prometheusURL     string
+	window            = "7d"
+	requestPercentile = 90.0
+	limitPercentile   = 99.0
+	headroom          float64
+	clusterLabel      string
+)
+
+//podPatterns match the names of the pods created by each kind, after the name of the object.
+var podPatterns = map[string]string{
+	"Deployment":  "-[a-z0-9]{1,10}-[a-z0-9]{5}",
+	"StatefulSet": "-[0-9]+",
+	"DaemonSet":   "-[a-z0-9]{5}",
+	"ReplicaSet":  "-[a-z0-9]{5}",
+	"Job":         "-[a-z0-9]{5}",
+	"CronJob":     "-[0-9]+-[a-z0-9]{5}",
+	"Pod":         "",
+}
+
+//queries are the usage of each resource, before the percentile over the window is taken.
+var queries = map[string]string{
+	"cpu":    "rate(container_cpu_usage_seconds_total{%s}[5m])[%s:5m]",
+	"memory": "container_memory_working_set_bytes{%s}[%s]",
+}
+
+type adapter struct{}
+
+func init() {
+	adapters.Register(adapter{})
+	support.RegisterSetting("prometheus-url")
+	support.RegisterSetting("prometheus-window")
+	support.RegisterSetting("prometheus-request-percentile")
+	support.RegisterSetting("prometheus-limit-percentile")
+	support.RegisterSetting("prometheus-headroom")
+	support.RegisterSetting("prometheus-cluster-label")
+}
+
+////////////////////////////////////////////////////////
+////////////////EXTERNAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//Name returns the name of the adapter
+func (adapter) Name() string {
+	return Name
+}
+
+//Initialize will ready the adapter to derive insights from the usage history held by prometheus.
+func (adapter) Initialize() error {
+
+	if err := loadQuerySettings(); err != nil {
+		return err
+	}
+
+	//use the stored url, unless one is supplied as a setting
+	storedSecrets := support.RetrieveSecrets("helm-optimize-plugin")
+	if storedSecrets != nil && storedSecrets["adapter"] == Name {
+		if val, ok := storedSecrets["prometheusURL"]; ok {
+			prometheusURL = val
+			explicitURL := false
+			if val, ok := support.Setting("prometheus-url"); ok {
+				prometheusURL, explicitURL = strings.TrimSuffix(val, "/"), true
+			}
+			err := validateURL()
+			if err == nil {
+				if support.Configuring {
+					storeSecrets()
+				}
+				return nil
+			}
+			if explicitURL {
+				return err
+			}
+		}
+	}
+
+	//offer the prometheus the data forwarder is configured with
+	defaultURL := ""
+	support.LoadConfigMap()
+	if support.Config != nil {
+		if address, ok := support.Config.Get("prometheus_address"); ok {
+			defaultURL = support.Config.GetString("prometheus_protocol", "http") + "://" + address + ":" + support.Config.GetString("prometheus_port", "9090")
+		}
+	}
+
+	for {
+		if defaultURL != "" {
+			prometheusURL = support.PromptDefault("prometheus-url", "Enter Prometheus URL ["+defaultURL+"]: ", defaultURL)
+		} else {
+			var err error
+			if prometheusURL, err = support.Prompt("prometheus-url", "Enter Prometheus URL: "); err != nil {
+				return err
+			}
+		}
+		prometheusURL = strings.TrimSuffix(prometheusURL, "/")
+		if err := validateURL(); err != nil {
+			if !support.CanPrompt("prometheus-url") {
+				return err
+			}
+			fmt.Println(err)
+			continue
+		}
+		break
+	}
+
+	if support.Configuring {
+		storeSecrets()
+	}
+
+	return nil
+
+}
+
+//GetInsight derives an insight from the usage percentiles of the container over the window, based on the keys cluster, namespace, objType, objName and containerName
+func (adapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+
+	selector := selector(cluster, namespace, objType, objName, containerName)
+
+	insightObj := map[string]map[string]string{}
+	for section, percentile := range map[string]float64{"requests": requestPercentile, "limits": limitPercentile} {
+		if percentile == 0 {
+			continue
+		}
+		insightObj[section] = map[string]string{}
+		for resource, query := range queries {
+			usage, err := queryValue("max(quantile_over_time(" + strconv.FormatFloat(percentile/100, 'f', -1, 64) + ", " + fmt.Sprintf(query, selector, window) + "))")
+			if err != nil {
+				return nil, "", err
+			}
+			value := usage * (1 + headroom/100)
+			switch resource {
+			case "cpu":
+				//an idle container still gets the smallest cpu kubernetes accepts
+				insightObj[section][resource] = quantity.Format(resource, math.Max(value, 0.001))
+			case "memory":
+				if usage <= 0 {
+					return nil, "", errors.New("no memory usage recorded for container [" + containerName + "]")
+				}
+				insightObj[section][resource] = quantity.Mebibytes(math.Ceil(value / (1 << 20)))
+			}
+		}
+	}
+
+	//recommendations derived from usage are not approved, they are always applied
+	return insightObj, "Approved", nil
+
+}
+
+//UpdateApprovalSetting is not supported, as recommendations derived from usage are always applied
+func (adapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+	return errors.New("approval settings are not supported by the " + Name + " adapter")
+}
+
+//GetApprovalSetting is not supported, as recommendations derived from usage are always applied
+func (adapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+	return "", errors.New("approval settings are not supported by the " + Name + " adapter")
+}
+
+////////////////////////////////////////////////////////
+///////////////////LOCAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//loadQuerySettings reads the window, percentiles, headroom and cluster label the recommendations are derived with.
+func loadQuerySettings() error {
+
+	if val, ok := support.Setting("prometheus-window"); ok {
+		if res1, _ := regexp.MatchString("^([0-9]+(ms|s|m|h|d|w|y))+$", val); !res1 {
+			return errors.New("invalid value [" + val + "] for setting prometheus-window -- use a prometheus duration, e.g. 7d")
+		}
+		window = val
+	}
+
+	for _, setting := range []struct {
+		key   string
+		value *float64
+	}{{"prometheus-request-percentile", &requestPercentile}, {"prometheus-limit-percentile", &limitPercentile}} {
+		if val, ok := support.Setting(setting.key); ok {
+			if val == "none" && setting.key == "prometheus-limit-percentile" {
+				*setting.value = 0
+				continue
+			}
+			percentile, err := strconv.ParseFloat(val, 64)
+			if err != nil || percentile <= 0 || percentile > 100 {
+				return errors.New("invalid value [" + val + "] for setting " + setting.key + " -- use a percentile between 0 and 100")
+			}
+			*setting.value = percentile
+		}
+	}
+
+	if val, ok := support.Setting("prometheus-headroom"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(val, "%"), 64)
+		if err != nil || percent < 0 {
+			return errors.New("invalid value [" + val + "] for setting prometheus-headroom -- use a percentage of 0 or more")
+		}
+		headroom = percent
+	}
+
+	if val, ok := support.Setting("prometheus-cluster-label"); ok {
+		clusterLabel = val
+	}
+
+	return nil
+
+}
+
+//selector returns the label matchers of the containers of the pods created by the objType/objName.
+func selector(cluster string, namespace string, objType string, objName string, containerName string) string {
+
+	pattern, ok := podPatterns[objType]
+	if !ok {
+		pattern = "-.+"
+	}
+
+	//escape the name for the regex, then the regex for the promql string
+	podRegex := strings.ReplaceAll(regexp.QuoteMeta(objName)+pattern, `\`, `\\`)
+	matchers := []string{`namespace="` + namespace + `"`, `pod=~"` + podRegex + `"`, `container="` + containerName + `"`}
+	if clusterLabel != "" {
+		matchers = append(matchers, clusterLabel+`="`+cluster+`"`)
+	}
+
+	return strings.Join(matchers, ",")
+
+}
+
+//queryValue runs an instant query that returns a single sample.
+func queryValue(query string) (float64, error) {
+
+	resp, err := support.HTTPRequest("GET", prometheusURL+"/api/v1/query?query="+url.QueryEscape(query), "", nil)
+	if err != nil {
+		var errResp map[string]interface{}
+		if json.Unmarshal([]byte(err.Error()), &errResp) == nil && errResp["error"] != nil {
+			return 0, errors.New("prometheus query failed -- " + fmt.Sprint(errResp["error"]))
+		}
+		return 0, errors.New("prometheus query failed -- " + err.Error())
+	}
+
+	var parsedResp struct {
+		Status string `json:"status"`
+		Data   struct {
+			Result []struct {
+				Value []interface{} `json:"value"`
+			} `json:"result"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(resp), &parsedResp); err != nil || parsedResp.Status != "success" {
+		return 0, errors.New("unable to parse prometheus response")
+	}
+
+	if len(parsedResp.Data.Result) == 0 || len(parsedResp.Data.Result[0].Value) != 2 {
+		return 0, errors.New("no usage history found in prometheus")
+	}
+
+	sample, _ := parsedResp.Data.Result[0].Value[1].(string)
+	value, err := strconv.ParseFloat(sample, 64)
+	if err != nil {
+		return 0, errors.New("unable to parse prometheus response")
+	}
+
+	return value, nil
+
+}
+
+func validateURL() error {
+
+	if _, err := queryValue("vector(1)"); err != nil {
+		return errors.New("unable to query prometheus at [" + prometheusURL + "] -- " + err.Error())
+	}
+
+	return nil
+
+}
+
+func storeSecrets() {
+
+	secrets := make(map[string]string)
+	secrets["adapter"] = Name
+	secrets["prometheusURL"] = prometheusURL
+	support.StoreSecrets("helm-optimize-plugin", secrets)
+
+}
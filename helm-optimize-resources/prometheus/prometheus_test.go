@@ -0,0 +1,176 @@
+package prometheus
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+//usageServer serves the sample of the first query fragment found in each query, and records the queries it was sent.
+func usageServer(t *testing.T, samples map[string]string) *[]string {
+
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		if r.URL.Path != "/api/v1/query" {
+			http.NotFound(w, r)
+			return
+		}
+
+		query := r.URL.Query().Get("query")
+		received = append(received, query)
+		for fragment, sample := range samples {
+			if strings.Contains(query, fragment) {
+				w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[{"metric":{},"value":[1700000000,"` + sample + `"]}]}}`))
+				return
+			}
+		}
+		w.Write([]byte(`{"status":"success","data":{"resultType":"vector","result":[]}}`))
+
+	}))
+
+	prometheusURL = server.URL
+	t.Cleanup(server.Close)
+
+	return &received
+
+}
+
+func TestGetInsight(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		headroom float64
+		limit    float64
+		samples  map[string]string
+		want     map[string]map[string]string
+		wantErr  string
+	}{
+		{
+			name:    "percentiles",
+			limit:   99,
+			samples: map[string]string{"0.9, rate": "0.2501", "0.99, rate": "0.75", "0.9, container_memory": "134217728", "0.99, container_memory": "209715201"},
+			want:    map[string]map[string]string{"requests": {"cpu": "251m", "memory": "128Mi"}, "limits": {"cpu": "750m", "memory": "201Mi"}},
+		},
+		{
+			name:     "headroom",
+			headroom: 50,
+			samples:  map[string]string{"0.9, rate": "0.1", "0.9, container_memory": "104857600"},
+			want:     map[string]map[string]string{"requests": {"cpu": "150m", "memory": "150Mi"}},
+		},
+		{
+			name:    "idle cpu",
+			samples: map[string]string{"0.9, rate": "0", "0.9, container_memory": "1048576"},
+			want:    map[string]map[string]string{"requests": {"cpu": "1m", "memory": "1Mi"}},
+		},
+		{
+			name:    "no memory usage",
+			samples: map[string]string{"0.9, rate": "0.1", "0.9, container_memory": "0"},
+			wantErr: "no memory usage recorded for container [app]",
+		},
+		{
+			name:    "no history",
+			samples: map[string]string{},
+			wantErr: "no usage history found in prometheus",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			received := usageServer(t, test.samples)
+			requestPercentile, limitPercentile, headroom, window = 90, test.limit, test.headroom, "7d"
+
+			insight, approval, err := adapter{}.GetInsight("prod", "shop", "Deployment", "web", "app")
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("GetInsight() error = %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("GetInsight() error = %v", err)
+			}
+			if approval != "Approved" {
+				t.Errorf("approval = %s, want Approved", approval)
+			}
+			if !reflect.DeepEqual(insight, test.want) {
+				t.Errorf("GetInsight() = %v, want %v", insight, test.want)
+			}
+			for _, query := range *received {
+				if !strings.Contains(query, `namespace="shop",pod=~"web-[a-z0-9]{1,10}-[a-z0-9]{5}",container="app"`) || !strings.Contains(query, "[7d") {
+					t.Errorf("query %s does not select the containers of the deployment over the window", query)
+				}
+			}
+
+		})
+	}
+
+}
+
+func TestQueryValue(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		want    float64
+		wantErr string
+	}{
+		{"sample", http.StatusOK, `{"status":"success","data":{"result":[{"value":[1700000000,"42.5"]}]}}`, 42.5, ""},
+		{"empty result", http.StatusOK, `{"status":"success","data":{"result":[]}}`, 0, "no usage history found in prometheus"},
+		{"not a sample", http.StatusOK, `{"status":"success","data":{"result":[{"value":[1700000000,"NaN?"]}]}}`, 0, "unable to parse prometheus response"},
+		{"bad query", http.StatusBadRequest, `{"status":"error","errorType":"bad_data","error":"parse error at char 4"}`, 0, "prometheus query failed -- parse error at char 4"},
+		{"not json", http.StatusOK, `<html></html>`, 0, "unable to parse prometheus response"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+				w.Write([]byte(test.body))
+			}))
+			defer server.Close()
+			prometheusURL = server.URL
+
+			value, err := queryValue("vector(1)")
+			if test.wantErr != "" {
+				if err == nil || err.Error() != test.wantErr {
+					t.Errorf("queryValue() error = %v, want %s", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil || value != test.want {
+				t.Errorf("queryValue() = %v, %v, want %v", value, err, test.want)
+			}
+
+		})
+	}
+
+}
+
+func TestSelector(t *testing.T) {
+
+	tests := []struct {
+		objType      string
+		objName      string
+		clusterLabel string
+		want         string
+	}{
+		{"StatefulSet", "db", "", `namespace="shop",pod=~"db-[0-9]+",container="app"`},
+		{"Pod", "web.v1", "", `namespace="shop",pod=~"web\\.v1",container="app"`},
+		{"Rollout", "web", "cluster", `namespace="shop",pod=~"web-.+",container="app",cluster="prod"`},
+	}
+
+	for _, test := range tests {
+		clusterLabel = test.clusterLabel
+		if got := selector("prod", "shop", test.objType, test.objName, "app"); got != test.want {
+			t.Errorf("selector(%s, %s) = %s, want %s", test.objType, test.objName, got, test.want)
+		}
+	}
+	clusterLabel = ""
+
+}
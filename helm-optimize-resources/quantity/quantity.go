@@ -0,0 +1,138 @@
+package quantity
+
+import (
+	"errors"
+	"math"
+	"regexp"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+//Parse parses any valid kubernetes quantity, e.g. 1.5, 250m, 512Mi, 1G or 1e3.
+func Parse(s string) (resource.Quantity, error) {
+
+	q, err := resource.ParseQuantity(s)
+	if err != nil {
+		return q, errors.New("invalid quantity [" + s + "]")
+	}
+
+	return q, nil
+
+}
+
+//Canonical returns the canonical form of a quantity of a resource, e.g. 0.5 becomes 500m and 1024Mi becomes 1Gi.  As in Format, cpu is
+//rounded up to whole millicores and every other resource to whole units, e.g. 250.5m cpu becomes 251m.
+func Canonical(resourceName string, s string) (string, error) {
+
+	q, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+
+	if resourceName == "cpu" {
+		return resource.NewMilliQuantity(q.MilliValue(), resource.DecimalSI).String(), nil
+	}
+
+	return resource.NewQuantity(q.Value(), q.Format).String(), nil
+
+}
+
+//Value returns a quantity in base units (cores or bytes).
+func Value(s string) (float64, error) {
+
+	q, err := Parse(s)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseFloat(q.AsDec().String(), 64)
+
+}
+
+//Compare returns -1, 0 or 1 when quantity a is less than, equal to or greater than quantity b.
+func Compare(a string, b string) (int, error) {
+
+	qa, err := Parse(a)
+	if err != nil {
+		return 0, err
+	}
+
+	qb, err := Parse(b)
+	if err != nil {
+		return 0, err
+	}
+
+	return qa.Cmp(qb), nil
+
+}
+
+//Format converts a value in base units into a canonical quantity.  cpu is rounded up to whole millicores, the smallest unit k8s accepts for it,
+//and every other resource to whole units.
+func Format(resourceName string, value float64) string {
+
+	if resourceName == "cpu" {
+		return resource.NewMilliQuantity(int64(math.Ceil(value*1000-1e-9)), resource.DecimalSI).String()
+	}
+
+	return resource.NewQuantity(int64(math.Round(value)), resource.BinarySI).String()
+
+}
+
+//Millicores converts a cpu value in millicores, e.g. 250.5, into a canonical quantity.
+func Millicores(value float64) string {
+	return Format("cpu", value/1000)
+}
+
+//Mebibytes converts a memory value in MiB, e.g. 128.5, into a canonical quantity.
+func Mebibytes(value float64) string {
+	return Format("memory", value*(1<<20))
+}
+
+//ResourceSpec validates a value of a resource spec stored in the layout of the Parameter Store adapter.  Bare numbers are read as millicores
+//of cpu and MiB of memory, as the spec has always been stored, while values with a unit may be any quantity, e.g. 1.5 cores written as 1500m.
+func ResourceSpec(resourceName string, val string) (string, error) {
+
+	if bare, _ := regexp.MatchString("^[0-9]+(\\.[0-9]+)?$", val); bare {
+		number, _ := strconv.ParseFloat(val, 64)
+		if number <= 0 {
+			return "", errors.New("quantity [" + val + "] must be greater than 0")
+		}
+		switch resourceName {
+		case "cpu":
+			return Millicores(number), nil
+		case "memory":
+			return Mebibytes(number), nil
+		}
+	}
+
+	value, err := Value(val)
+	if err != nil {
+		return "", err
+	}
+	if value <= 0 {
+		return "", errors.New("quantity [" + val + "] must be greater than 0")
+	}
+
+	return Canonical(resourceName, val)
+
+}
+
+//Normalize validates every value of a limits/requests map and returns it with canonical quantities.
+func Normalize(resources map[string]map[string]string) (map[string]map[string]string, error) {
+
+	normalized := map[string]map[string]string{}
+	for section, values := range resources {
+		normalized[section] = map[string]string{}
+		for resourceName, val := range values {
+			canonical, err := Canonical(resourceName, val)
+			if err != nil {
+				return nil, errors.New("invalid quantity [" + val + "] for " + section + "." + resourceName)
+			}
+			normalized[section][resourceName] = canonical
+		}
+	}
+
+	return normalized, nil
+
+}
@@ -0,0 +1,128 @@
+package quantity
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+
+	tests := []struct {
+		resource string
+		value    string
+		want     string
+		wantErr  bool
+	}{
+		{"cpu", "0.5", "500m", false},
+		{"cpu", "2", "2", false},
+		{"cpu", "1500m", "1500m", false},
+		{"cpu", "250.5m", "251m", false},
+		{"cpu", "1e-4", "1m", false},
+		{"memory", "1024Mi", "1Gi", false},
+		{"memory", "1.5Gi", "1536Mi", false},
+		{"memory", "1G", "1G", false},
+		{"memory", "0.5", "1", false},
+		{"ephemeral-storage", "2048Ki", "2Mi", false},
+		{"cpu", "lots", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := Canonical(test.resource, test.value)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("Canonical(%s, %s) = %s, %v, want %s", test.resource, test.value, got, err, test.want)
+		}
+	}
+
+}
+
+func TestFormat(t *testing.T) {
+
+	tests := []struct {
+		resource string
+		value    float64
+		want     string
+	}{
+		{"cpu", 0.25, "250m"},
+		{"cpu", 0.2501, "251m"},
+		{"cpu", 0.15000000000000002, "150m"},
+		{"cpu", 1, "1"},
+		{"memory", 134217728, "128Mi"},
+		{"memory", 1073741824.4, "1Gi"},
+	}
+
+	for _, test := range tests {
+		if got := Format(test.resource, test.value); got != test.want {
+			t.Errorf("Format(%s, %v) = %s, want %s", test.resource, test.value, got, test.want)
+		}
+	}
+
+	if got := Millicores(250.5); got != "251m" {
+		t.Errorf("Millicores(250.5) = %s, want 251m", got)
+	}
+	if got := Mebibytes(1024); got != "1Gi" {
+		t.Errorf("Mebibytes(1024) = %s, want 1Gi", got)
+	}
+
+}
+
+func TestResourceSpec(t *testing.T) {
+
+	tests := []struct {
+		resource string
+		value    string
+		want     string
+		wantErr  bool
+	}{
+		{"cpu", "500", "500m", false},
+		{"cpu", "250.5", "251m", false},
+		{"memory", "256", "256Mi", false},
+		{"memory", "1024", "1Gi", false},
+		{"cpu", "1500m", "1500m", false},
+		{"memory", "1Gi", "1Gi", false},
+		{"nvidia.com/gpu", "1", "1", false},
+		{"cpu", "0", "", true},
+		{"memory", "-1Gi", "", true},
+		{"memory", "lots", "", true},
+	}
+
+	for _, test := range tests {
+		got, err := ResourceSpec(test.resource, test.value)
+		if (err != nil) != test.wantErr || got != test.want {
+			t.Errorf("ResourceSpec(%s, %s) = %s, %v, want %s", test.resource, test.value, got, err, test.want)
+		}
+	}
+
+}
+
+func TestNormalize(t *testing.T) {
+
+	got, err := Normalize(map[string]map[string]string{"limits": {"cpu": "1.5", "memory": "2048Mi"}, "requests": {"cpu": "0.25"}})
+	want := map[string]map[string]string{"limits": {"cpu": "1500m", "memory": "2Gi"}, "requests": {"cpu": "250m"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Normalize() = %v, %v, want %v", got, err, want)
+	}
+
+	if _, err := Normalize(map[string]map[string]string{"limits": {"memory": "lots"}}); err == nil || err.Error() != "invalid quantity [lots] for limits.memory" {
+		t.Errorf("Normalize() error = %v, want invalid quantity [lots] for limits.memory", err)
+	}
+
+}
+
+func TestCompare(t *testing.T) {
+
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"500m", "0.5", 0},
+		{"1Gi", "1G", 1},
+		{"100m", "1", -1},
+	}
+
+	for _, test := range tests {
+		if got, err := Compare(test.a, test.b); err != nil || got != test.want {
+			t.Errorf("Compare(%s, %s) = %d, %v, want %d", test.a, test.b, got, err, test.want)
+		}
+	}
+
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//results holds every container resolved during this run, in the order they were processed.
+var results []containerResult
+
+func init() {
+	support.RegisterSetting("report")
+	support.RegisterSetting("report-file")
+}
+
+//reportRecord is the machine-readable form of a containerResult.
+type reportRecord struct {
+	Chart           string                       `json:"chart"`
+	Namespace       string                       `json:"namespace"`
+	ObjType         string                       `json:"objType"`
+	ObjName         string                       `json:"objName"`
+	Container       string                       `json:"container"`
+	InitContainer   bool                         `json:"initContainer,omitempty"`
+	ApprovalSetting string                       `json:"approvalSetting,omitempty"`
+	Source          string                       `json:"source"`
+	FetchedAt       string                       `json:"fetchedAt,omitempty"`
+	Stale           bool                         `json:"stale,omitempty"`
+	Policy          []string                     `json:"policy,omitempty"`
+	Merge           []string                     `json:"merge,omitempty"`
+	Before          map[string]map[string]string `json:"before"`
+	After           map[string]map[string]string `json:"after"`
+}
+
+//writeReport writes the optimization report in the format requested by the report setting.  Nothing is written if no report was requested.
+func writeReport() error {
+
+	format, ok := support.Setting("report")
+	if !ok {
+		return nil
+	}
+
+	if format != "json" && format != "markdown" {
+		return errors.New("invalid value [" + format + "] for setting report -- use json or markdown")
+	}
+
+	var w io.Writer = out
+	if path, ok := support.Setting("report-file"); ok {
+		reportFile, err := os.Create(path)
+		if err != nil {
+			return errors.New("unable to create report file [" + path + "]")
+		}
+		defer reportFile.Close()
+		w = reportFile
+	}
+
+	if format == "json" {
+		return writeJSONReport(w)
+	}
+
+	return writeMarkdownReport(w)
+
+}
+
+func writeJSONReport(w io.Writer) error {
+
+	records := []reportRecord{}
+	for _, result := range results {
+		records = append(records, reportRecord{
+			Chart:           result.chart,
+			Namespace:       result.namespace,
+			ObjType:         result.objType,
+			ObjName:         result.objName,
+			Container:       result.container,
+			InitContainer:   result.initContainer,
+			ApprovalSetting: result.approvalSetting,
+			Source:          result.source,
+			FetchedAt:       fetchedAt(result),
+			Stale:           result.stale,
+			Policy:          result.policyNotes,
+			Merge:           result.mergeNotes,
+			Before:          result.original,
+			After:           result.resources,
+		})
+	}
+
+	report := map[string]interface{}{
+		"cluster":    remoteCluster,
+		"adapter":    adapter.Name(),
+		"containers": records,
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(report)
+
+}
+
+func writeMarkdownReport(w io.Writer) error {
+
+	var sb strings.Builder
+	sb.WriteString("### Resource Optimization\n\n")
+	sb.WriteString("Cluster: `" + remoteCluster + "`  Adapter: `" + adapter.Name() + "`\n\n")
+
+	columns := resultColumns(results)
+	header, separator := "| Chart | Namespace | Kind | Name | Container | Approval | Source |", "|---|---|---|---|---|---|---|"
+	for _, column := range columns {
+		header += " " + column.heading + " |"
+		separator += "---|"
+	}
+	sb.WriteString(header + "\n" + separator + "\n")
+
+	for _, result := range results {
+		source := result.source
+		if result.stale {
+			source += " (stale, fetched " + fetchedAt(result) + ")"
+		}
+		if len(result.policyNotes) > 0 {
+			source += " (clamped: " + strings.Join(result.policyNotes, "; ") + ")"
+		}
+		if len(result.mergeNotes) > 0 {
+			source += " (merged: " + strings.Join(result.mergeNotes, "; ") + ")"
+		}
+		sb.WriteString("| " + strings.Join([]string{result.chart, result.namespace, result.objType, result.objName, result.container, result.approvalSetting, source}, " | ") + " |")
+		for _, column := range columns {
+			sb.WriteString(" " + diffCell(result.original[column.section][column.resource], result.resources[column.section][column.resource]) + " |")
+		}
+		sb.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+
+	return err
+
+}
+
+//fetchedAt returns when the insight of a result was fetched from the adapter, or an empty string if it didn't come from the adapter.
+func fetchedAt(result containerResult) string {
+
+	if result.fetchedAt.IsZero() {
+		return ""
+	}
+
+	return result.fetchedAt.UTC().Format(time.RFC3339)
+
+}
+
+//chartFromSource returns the name of the chart a rendered manifest came from, using the '# Source:' comment helm adds to each document.
+func chartFromSource(manifest string) string {
+
+	if source := sourceComment(manifest); source != "" {
+		source = strings.TrimSpace(strings.TrimPrefix(source, "# Source: "))
+		if pos := strings.LastIndex(source, "/templates/"); pos > -1 {
+			source = source[:pos]
+		}
+		return source[strings.LastIndex(source, "/")+1:]
+	}
+
+	return ""
+
+}
+
+//sourceComment returns the '# Source:' line of a rendered manifest, including its line break, so it can be carried over when the manifest is rewritten.
+func sourceComment(manifest string) string {
+
+	for _, line := range strings.Split(manifest, "\n") {
+		if strings.HasPrefix(line, "# Source: ") {
+			return line + "\n"
+		}
+	}
+
+	return ""
+
+}
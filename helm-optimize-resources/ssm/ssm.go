@@ -5,80 +5,159 @@ import (
 	"errors"
 	"fmt"
 	"regexp"
-	"strconv"
-
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awsssm "github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/aws/aws-sdk-go/service/sts/stsiface"
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
 	"github.com/densify-quick-start/helm-optimize-resources/support"
 )
 
+//Name is the name the Parameter Store adapter is registered and stored under.
+const Name = "Parameter Store"
+
+var (
+	prefix   string
+	profile  string
+	region   string
+	endpoint string
+)
+
+//SSMClient and STSClient are built from the resolved profile, region and endpoint when the adapter is initialized.
+//They can be replaced afterwards, e.g. with fakes.
+var (
+	SSMClient ssmiface.SSMAPI
+	STSClient stsiface.STSAPI
+)
+
+//parameter is a resource spec parameter, with the approval label of its latest version.
+type parameter struct {
+	value   string
+	version int64
+	label   string
+}
+
+//parameterCache holds the parameters prefetched under each prefix/cluster/namespace path, keyed by parameter name.
+//A nil entry means the path could not be prefetched, and parameters are read one at a time instead.
 var (
-	prefix  string
-	profile string
-	region  string
+	cacheMu        sync.Mutex
+	parameterCache = make(map[string]map[string]parameter)
 )
 
+//legacyTags are the tag names the cpu and memory of a resource spec were recorded under before any resource could be tagged.
+var legacyTags = map[string]string{
+	"currentCpuLimit":       "current:limits:cpu",
+	"currentMemLimit":       "current:limits:memory",
+	"currentCpuRequest":     "current:requests:cpu",
+	"currentMemRequest":     "current:requests:memory",
+	"recommendedCpuLimit":   "recommended:limits:cpu",
+	"recommendedMemLimit":   "recommended:limits:memory",
+	"recommendedCpuRequest": "recommended:requests:cpu",
+	"recommendedMemRequest": "recommended:requests:memory",
+}
+
 var supportedRegions = []string{"us-east-2", "us-east-1", "us-west-1", "us-west-2", "af-south-1", "ap-east-1", "ap-south-1", "ap-northeast-3", "ap-northeast-2", "ap-southeast-1", "ap-southeast-2", "ap-northeast-1", "ca-central-1", "cn-north-1", "cn-northwest-1", "eu-central-1", "eu-west-1", "eu-west-2", "eu-south-1", "eu-west-3", "eu-north-1", "me-south-1", "sa-east-1", "us-gov-east-1", "us-gov-west-1"}
 
+type adapter struct{}
+
+func init() {
+	adapters.Register(adapter{})
+	support.RegisterSetting("ssm-prefix")
+	support.RegisterSetting("ssm-profile")
+	support.RegisterSetting("ssm-region")
+	support.RegisterSetting("ssm-endpoint")
+}
+
 ////////////////////////////////////////////////////////
 ////////////////EXTERNAL FUNCTIONS//////////////////////
 ////////////////////////////////////////////////////////
 
-//Initialize will ready the adapter to serve insight extraction from AWS parameter store.
-func Initialize() error {
+//Name returns the name of the adapter
+func (adapter) Name() string {
+	return Name
+}
 
-	//Check dependancies
-	if _, _, err := support.ExecuteSingleCommand([]string{"aws", "--version"}); err != nil {
-		return errors.New("aws-cli is not available - please install before trying again")
-	}
+//Initialize will ready the adapter to serve insight extraction from AWS parameter store.
+func (adapter) Initialize() error {
 
-	//check stored secret
+	//use the stored configuration, with each setting that is supplied taking precedence over its stored value
 	storedSecrets := support.RetrieveSecrets("helm-optimize-plugin")
-	if storedSecrets != nil && storedSecrets["adapter"] == "Parameter Store" {
+	if storedSecrets != nil && storedSecrets["adapter"] == Name {
 		if _, ok := storedSecrets["region"]; ok {
 			region = storedSecrets["region"]
 			prefix = storedSecrets["prefix"]
 			profile = storedSecrets["profile"]
+			endpoint = storedSecrets["endpoint"]
+			for key, value := range map[string]*string{"ssm-prefix": &prefix, "ssm-profile": &profile, "ssm-region": &region, "ssm-endpoint": &endpoint} {
+				if val, ok := support.Setting(key); ok {
+					*value = val
+				}
+			}
+			if err := validatePrefix(prefix); err != nil {
+				return err
+			}
+			if err := validateRegion(region); err != nil {
+				return err
+			}
+			if err := newClients(); err != nil {
+				return err
+			}
+			if support.Configuring {
+				storeSecrets()
+			}
 			return nil
 		}
 	}
 
 	//extract ssm secrets from user
 	for {
-		fmt.Print("What is your preferred parameter key prefix [no prefix]: ")
-		fmt.Scanln(&prefix)
-		if prefix != "" {
-			if res1, _ := regexp.MatchString("^/{0,1}(aws|ssm)", prefix); res1 {
-				fmt.Println("Parameter name: can't be prefixed with \"aws\" or \"ssm\" (case-insensitive).")
-				continue
-			}
-
-			if res1, _ := regexp.MatchString("^(/{1}[a-zA-Z0-9_.-]+)*$", prefix); !res1 {
-				fmt.Println("Only a mix of letters, numbers and the following 3 symbols .-_ are allowed.  e.g /prefix/path")
-				continue
+		prefix = support.PromptDefault("ssm-prefix", "What is your preferred parameter key prefix [no prefix]: ", "")
+		if err := validatePrefix(prefix); err != nil {
+			if !support.CanPrompt("ssm-prefix") {
+				return err
 			}
+			fmt.Println(err)
+			continue
 		}
 		break
 	}
 
 	for {
-		fmt.Print("What is your preferred AWS profile [default]: ")
-		fmt.Scanln(&profile)
-		if profile == "" {
-			profile = "default"
-		}
-		_, stdErr, err := support.ExecuteSingleCommand([]string{"aws", "sts", "get-caller-identity", "--profile", profile})
-		if found := support.CheckError(stdErr, err, false); !found {
-			break
+		region = support.PromptDefault("ssm-region", "What is your preferred AWS region [us-east-1]: ", "us-east-1")
+		if err := validateRegion(region); err != nil {
+			if !support.CanPrompt("ssm-region") {
+				return err
+			}
+			fmt.Println(err)
+			continue
 		}
+		break
+	}
+
+	if val, ok := support.Setting("ssm-endpoint"); ok {
+		endpoint = val
 	}
 
 	for {
-		fmt.Print("What is your preferred AWS region [us-east-1]: ")
-		fmt.Scanln(&region)
-		if region == "" {
-			region = "us-east-1"
+		profile = support.PromptDefault("ssm-profile", "What is your preferred AWS profile [default]: ", "")
+		if err := newClients(); err != nil {
+			if !support.CanPrompt("ssm-profile") {
+				return err
+			}
+			fmt.Println(err)
+			continue
 		}
-		if _, ok := support.InSlice(supportedRegions, region); !ok {
-			fmt.Println("Invalid entry.  Check for valid regions here https://aws.amazon.com/about-aws/global-infrastructure/regions_az/.")
+		if _, err := STSClient.GetCallerIdentity(&sts.GetCallerIdentityInput{}); err != nil {
+			if !support.CanPrompt("ssm-profile") {
+				return errors.New("unable to authenticate with AWS profile [" + profile + "] -- " + err.Error())
+			}
+			fmt.Println(err)
 			continue
 		}
 		break
@@ -91,111 +170,89 @@ func Initialize() error {
 }
 
 //GetInsight gets an insight from parameter store based on the keys cluster, namespace, objType, objName and containerName
-func GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+func (adapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
 
 	ssmKey := prefix + "/" + cluster + "/" + namespace + "/" + objType + "/" + objName + "/" + containerName + "/resourceSpec"
 
-	insight, insightVersion, err := getParameterValue(ssmKey)
+	param, err := getParameter(cluster, namespace, ssmKey)
 	if err != nil {
 		return nil, "", errors.New("could not locate resource spec")
 	}
+	insight := param.value
 
 	//Validate and acquire resource spec
 	var parsedInsight map[string]map[string]string
-	json.Unmarshal([]byte(insight), &parsedInsight)
-
-	if cpuLimit, err := strconv.Atoi(parsedInsight["limits"]["cpu"]); err != nil || cpuLimit < 1 {
+	if err := json.Unmarshal([]byte(insight), &parsedInsight); err != nil {
 		return nil, "", errors.New("invalid resource specs received from repository")
 	}
 
-	if memLimit, err := strconv.Atoi(parsedInsight["limits"]["memory"]); err != nil || memLimit < 1 {
+	if len(parsedInsight["limits"])+len(parsedInsight["requests"]) == 0 {
 		return nil, "", errors.New("invalid resource specs received from repository")
 	}
-
-	if cpuRequest, err := strconv.Atoi(parsedInsight["requests"]["cpu"]); err != nil || cpuRequest < 1 {
-		return nil, "", errors.New("invalid resource specs received from repository")
-	}
-
-	if memRequest, err := strconv.Atoi(parsedInsight["requests"]["memory"]); err != nil || memRequest < 1 {
-		return nil, "", errors.New("invalid resource specs received from repository")
+	for _, section := range []string{"limits", "requests"} {
+		for resource, val := range parsedInsight[section] {
+			canonical, err := quantity.ResourceSpec(resource, val)
+			if err != nil {
+				return nil, "", errors.New("invalid resource specs received from repository -- " + err.Error())
+			}
+			parsedInsight[section][resource] = canonical
+		}
 	}
 
-	parsedInsight["limits"]["cpu"] = parsedInsight["limits"]["cpu"] + "m"
-	parsedInsight["limits"]["memory"] = parsedInsight["limits"]["memory"] + "Mi"
-	parsedInsight["requests"]["cpu"] = parsedInsight["requests"]["cpu"] + "m"
-	parsedInsight["requests"]["memory"] = parsedInsight["requests"]["memory"] + "Mi"
-
 	//Acquire approval setting
-	approvalSetting, err := getParameterLabel(ssmKey, insightVersion)
-	if err != nil {
+	if param.label == "" {
 		return nil, "", errors.New("unable to read approval setting")
 	}
 
-	return parsedInsight, approvalSetting, nil
+	return parsedInsight, param.label, nil
 
 }
 
 //UpdateApprovalSetting will update the approval setting accordingly
-func UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+func (adapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
 
 	ssmKey := prefix + "/" + cluster + "/" + namespace + "/" + objType + "/" + objName + "/" + containerName + "/resourceSpec"
 
-	resp, _, err := support.ExecuteSingleCommand([]string{"aws", "ssm", "list-tags-for-resource", "--resource-type", "Parameter", "--resource-id", ssmKey, "--profile", profile, "--region", region, "--query", "TagList"})
+	resp, err := SSMClient.ListTagsForResource(&awsssm.ListTagsForResourceInput{
+		ResourceType: aws.String(awsssm.ResourceTypeForTaggingParameter),
+		ResourceId:   aws.String(ssmKey),
+	})
 	if err != nil {
 		return errors.New("unable to update approval setting")
 	}
 
-	var tagMap []map[string]string
-	json.Unmarshal([]byte(resp), &tagMap)
-
-	currentSettings := make(map[string]map[string]string)
-	recommendedSettings := make(map[string]map[string]string)
-	currentSettings["limits"] = make(map[string]string)
-	currentSettings["requests"] = make(map[string]string)
-	recommendedSettings["limits"] = make(map[string]string)
-	recommendedSettings["requests"] = make(map[string]string)
-	for _, val := range tagMap {
-		if val["Key"] == "currentCpuLimit" {
-			currentSettings["limits"]["cpu"] = val["Value"]
-		} else if val["Key"] == "currentMemLimit" {
-			currentSettings["limits"]["memory"] = val["Value"]
-		} else if val["Key"] == "currentCpuRequest" {
-			currentSettings["requests"]["cpu"] = val["Value"]
-		} else if val["Key"] == "currentMemRequest" {
-			currentSettings["requests"]["memory"] = val["Value"]
-		} else if val["Key"] == "recommendedCpuLimit" {
-			recommendedSettings["limits"]["cpu"] = val["Value"]
-		} else if val["Key"] == "recommendedMemLimit" {
-			recommendedSettings["limits"]["memory"] = val["Value"]
-		} else if val["Key"] == "recommendedCpuRequest" {
-			recommendedSettings["requests"]["cpu"] = val["Value"]
-		} else if val["Key"] == "recommendedMemRequest" {
-			recommendedSettings["requests"]["memory"] = val["Value"]
+	settings := map[string]map[string]map[string]string{
+		"current":     {"limits": {}, "requests": {}},
+		"recommended": {"limits": {}, "requests": {}},
+	}
+	for _, tag := range resp.TagList {
+		key, val := aws.StringValue(tag.Key), aws.StringValue(tag.Value)
+		if legacyKey, ok := legacyTags[key]; ok {
+			key = legacyKey
 		}
+		//tags are named <current|recommended>:<limits|requests>:<resource>, e.g. recommended:limits:nvidia.com/gpu
+		parts := strings.SplitN(key, ":", 3)
+		if len(parts) != 3 || settings[parts[0]] == nil || settings[parts[0]][parts[1]] == nil {
+			continue
+		}
+		settings[parts[0]][parts[1]][parts[2]] = val
+	}
+
+	currentSettings, recommendedSettings := settings["current"], settings["recommended"]
+	if approved && len(recommendedSettings["limits"])+len(recommendedSettings["requests"]) == 0 {
+		return errors.New("unable to update approval setting -- no recommended resources are tagged")
+	}
+	if !approved && len(currentSettings["limits"])+len(currentSettings["requests"]) == 0 {
+		return errors.New("unable to update approval setting -- no current resources are tagged")
 	}
 
-	var err1, err2 error
 	if approved == true {
-		recommendedSettingsJSON, err := json.Marshal(recommendedSettings)
-		if err != nil {
-			return errors.New("unable to update approval setting")
-		}
-		_, _, err1 = support.ExecuteSingleCommand([]string{"aws", "ssm", "put-parameter", "--name", ssmKey, "--type", "String", "--value", string(recommendedSettingsJSON), "--overwrite", "--profile", profile, "--region", region})
-		if err1 == nil {
-			_, _, err2 = support.ExecuteSingleCommand([]string{"aws", "ssm", "label-parameter-version", "--name", ssmKey, "--labels", "Approved", "--profile", profile, "--region", region})
-		}
+		err = putLabeledParameter(cluster, namespace, ssmKey, recommendedSettings, "Approved")
 	} else {
-		currentSettingsJSON, err := json.Marshal(currentSettings)
-		if err != nil {
-			return errors.New("unable to update approval setting")
-		}
-		_, _, err1 = support.ExecuteSingleCommand([]string{"aws", "ssm", "put-parameter", "--name", ssmKey, "--type", "String", "--value", string(currentSettingsJSON), "--overwrite", "--profile", profile, "--region", region})
-		if err1 == nil {
-			_, _, err2 = support.ExecuteSingleCommand([]string{"aws", "ssm", "label-parameter-version", "--name", ssmKey, "--labels", "NotApproved", "--profile", profile, "--region", region})
-		}
+		err = putLabeledParameter(cluster, namespace, ssmKey, currentSettings, "NotApproved")
 	}
 
-	if err1 != nil || err2 != nil {
+	if err != nil {
 		return errors.New("unable to update approval setting")
 	}
 
@@ -204,22 +261,16 @@ func UpdateApprovalSetting(approved bool, cluster string, namespace string, objT
 }
 
 //GetApprovalSetting will acquire the current approval setting
-func GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+func (adapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
 
 	ssmKey := prefix + "/" + cluster + "/" + namespace + "/" + objType + "/" + objName + "/" + containerName + "/resourceSpec"
 
-	_, insightVersion, err := getParameterValue(ssmKey)
-	if err != nil {
-		return "", errors.New("unable to read approval setting")
-	}
-
-	//Acquire approval setting
-	approvalSetting, err := getParameterLabel(ssmKey, insightVersion)
-	if err != nil {
+	param, err := getParameter(cluster, namespace, ssmKey)
+	if err != nil || param.label == "" {
 		return "", errors.New("unable to read approval setting")
 	}
 
-	return approvalSetting, nil
+	return param.label, nil
 
 }
 
@@ -227,50 +278,236 @@ func GetApprovalSetting(cluster string, namespace string, objType string, objNam
 ///////////////////LOCAL FUNCTIONS//////////////////////
 ////////////////////////////////////////////////////////
 
-func getParameterValue(ssmKey string) (string, string, error) {
+func newClients() error {
 
-	insight, _, err := support.ExecuteSingleCommand([]string{"aws", "ssm", "get-parameter", "--with-decryption", "--name", ssmKey, "--profile", profile, "--region", region})
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
+		Config: aws.Config{
+			Region:   aws.String(region),
+			Endpoint: aws.String(endpoint),
+		},
+	})
 	if err != nil {
-		return "", "", errors.New("could not locate resource spec")
+		return errors.New("unable to load AWS profile [" + profile + "] -- " + err.Error())
 	}
 
-	var insightMap map[string]map[string]interface{}
-	json.Unmarshal([]byte(insight), &insightMap)
+	SSMClient = awsssm.New(sess)
+	STSClient = sts.New(sess)
 
-	return insightMap["Parameter"]["Value"].(string), strconv.FormatFloat(insightMap["Parameter"]["Version"].(float64), 'E', -1, 64), nil
+	return nil
 
 }
 
-func getParameterLabel(ssmKey string, version string) (string, error) {
+//getParameter returns a resource spec parameter.  The first lookup in a namespace prefetches every parameter under prefix/cluster/namespace.
+func getParameter(cluster string, namespace string, ssmKey string) (parameter, error) {
+
+	path := prefix + "/" + cluster + "/" + namespace
 
-	paramHistory, _, err := support.ExecuteSingleCommand([]string{"aws", "ssm", "get-parameter-history", "--with-decryption", "--name", ssmKey, "--profile", profile, "--region", region, "--query", "Parameters"})
+	cacheMu.Lock()
+	cached, ok := parameterCache[path]
+	if !ok {
+		//the prefetch fails when the caller may only read single parameters, e.g. ssm:GetParameter without ssm:GetParametersByPath
+		cached, _ = prefetchParameters(path)
+		parameterCache[path] = cached
+	}
+	param, found := cached[ssmKey]
+	cacheMu.Unlock()
+
+	if cached != nil {
+		if !found {
+			return parameter{}, errors.New("could not locate resource spec")
+		}
+		return param, nil
+	}
+
+	value, version, err := getParameterValue(ssmKey)
 	if err != nil {
-		return "", errors.New("unable to read approval setting")
+		return parameter{}, err
 	}
+	label, _ := getParameterLabel(ssmKey, version)
+
+	return parameter{value, version, label}, nil
 
-	var paramHistoryMap []map[string]interface{}
-	json.Unmarshal([]byte(paramHistory), &paramHistoryMap)
-	for _, val := range paramHistoryMap {
-		if strconv.FormatFloat(val["Version"].(float64), 'E', -1, 64) == version && len(val["Labels"].([]interface{})) == 1 {
-			if val["Labels"].([]interface{})[0].(string) == "NotApproved" {
-				return "Not Approved", nil
-			} else if val["Labels"].([]interface{})[0].(string) == "Approved" {
-				return "Approved", nil
+}
+
+//prefetchParameters reads every parameter under the path, along with the approval label of its latest version.
+func prefetchParameters(path string) (map[string]parameter, error) {
+
+	params := make(map[string]parameter)
+	if err := getParametersByPath(path, "", func(param *awsssm.Parameter) {
+		params[aws.StringValue(param.Name)] = parameter{value: aws.StringValue(param.Value), version: aws.Int64Value(param.Version)}
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, label := range []string{"Approved", "NotApproved"} {
+		if err := getParametersByPath(path, label, func(param *awsssm.Parameter) {
+			name := aws.StringValue(param.Name)
+			if latest, ok := params[name]; ok && latest.version == aws.Int64Value(param.Version) {
+				latest.label = approvalLabel(label)
+				params[name] = latest
+			}
+		}); err != nil {
+			return nil, err
+		}
+	}
+
+	return params, nil
+
+}
+
+//getParametersByPath pages through the parameters under the path.  When label is set, only the versions carrying the label are returned.
+func getParametersByPath(path string, label string, fn func(*awsssm.Parameter)) error {
+
+	input := &awsssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	}
+	if label != "" {
+		input.ParameterFilters = []*awsssm.ParameterStringFilter{{
+			Key:    aws.String("Label"),
+			Option: aws.String("Equals"),
+			Values: []*string{aws.String(label)},
+		}}
+	}
+
+	return SSMClient.GetParametersByPathPages(input, func(page *awsssm.GetParametersByPathOutput, lastPage bool) bool {
+		for _, param := range page.Parameters {
+			fn(param)
+		}
+		return true
+	})
+
+}
+
+//approvalLabel converts a parameter label to the approval setting shown to the user.
+func approvalLabel(label string) string {
+
+	if label == "NotApproved" {
+		return "Not Approved"
+	}
+
+	return label
+
+}
+
+func getParameterValue(ssmKey string) (string, int64, error) {
+
+	resp, err := SSMClient.GetParameter(&awsssm.GetParameterInput{
+		Name:           aws.String(ssmKey),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", 0, errors.New("could not locate resource spec")
+	}
+
+	return aws.StringValue(resp.Parameter.Value), aws.Int64Value(resp.Parameter.Version), nil
+
+}
+
+func getParameterLabel(ssmKey string, version int64) (string, error) {
+
+	var labels []*string
+	err := SSMClient.GetParameterHistoryPages(&awsssm.GetParameterHistoryInput{
+		Name:           aws.String(ssmKey),
+		WithDecryption: aws.Bool(true),
+	}, func(page *awsssm.GetParameterHistoryOutput, lastPage bool) bool {
+		for _, param := range page.Parameters {
+			if aws.Int64Value(param.Version) == version {
+				labels = param.Labels
+				return false
 			}
 		}
+		return true
+	})
+	if err != nil {
+		return "", errors.New("unable to read approval setting")
+	}
+
+	if len(labels) == 1 && (aws.StringValue(labels[0]) == "NotApproved" || aws.StringValue(labels[0]) == "Approved") {
+		return approvalLabel(aws.StringValue(labels[0])), nil
 	}
 
 	return "", errors.New("unable to read parameter label")
 
 }
 
+//putLabeledParameter writes a new version of the parameter and moves the label to it.
+func putLabeledParameter(cluster string, namespace string, ssmKey string, settings map[string]map[string]string, label string) error {
+
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	resp, err := SSMClient.PutParameter(&awsssm.PutParameterInput{
+		Name:      aws.String(ssmKey),
+		Type:      aws.String(awsssm.ParameterTypeString),
+		Value:     aws.String(string(settingsJSON)),
+		Overwrite: aws.Bool(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = SSMClient.LabelParameterVersion(&awsssm.LabelParameterVersionInput{
+		Name:             aws.String(ssmKey),
+		ParameterVersion: resp.Version,
+		Labels:           []*string{aws.String(label)},
+	})
+	if err != nil {
+		return err
+	}
+
+	cacheMu.Lock()
+	if cached := parameterCache[prefix+"/"+cluster+"/"+namespace]; cached != nil {
+		cached[ssmKey] = parameter{string(settingsJSON), aws.Int64Value(resp.Version), approvalLabel(label)}
+	}
+	cacheMu.Unlock()
+
+	return nil
+
+}
+
+//validatePrefix checks the parameter key prefix follows the naming rules of parameter store.
+func validatePrefix(prefix string) error {
+
+	if prefix == "" {
+		return nil
+	}
+
+	if res1, _ := regexp.MatchString("^/{0,1}(aws|ssm)", prefix); res1 {
+		return errors.New("invalid ssm-prefix [" + prefix + "] -- parameter names can't be prefixed with \"aws\" or \"ssm\" (case-insensitive)")
+	}
+
+	if res1, _ := regexp.MatchString("^(/{1}[a-zA-Z0-9_.-]+)*$", prefix); !res1 {
+		return errors.New("invalid ssm-prefix [" + prefix + "] -- only a mix of letters, numbers and .-_ are allowed.  e.g /prefix/path")
+	}
+
+	return nil
+
+}
+
+func validateRegion(region string) error {
+
+	if _, ok := support.InSlice(supportedRegions, region); !ok {
+		return errors.New("invalid ssm-region [" + region + "] -- check for valid regions here https://aws.amazon.com/about-aws/global-infrastructure/regions_az/")
+	}
+
+	return nil
+
+}
+
 func storeSecrets() {
 
 	secrets := make(map[string]string)
-	secrets["adapter"] = "Parameter Store"
+	secrets["adapter"] = Name
 	secrets["profile"] = profile
 	secrets["prefix"] = prefix
 	secrets["region"] = region
+	secrets["endpoint"] = endpoint
 	support.StoreSecrets("helm-optimize-plugin", secrets)
 
 }
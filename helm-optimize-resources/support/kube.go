@@ -0,0 +1,335 @@
+package support
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+//Typed causes of a KubeError.  Check them with errors.Is.
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrForbidden   = errors.New("forbidden")
+	ErrUnreachable = errors.New("unreachable")
+)
+
+//KubeError is returned when a request to the cluster fails.
+type KubeError struct {
+	Cause   error
+	Message string
+}
+
+func (e *KubeError) Error() string {
+	return e.Message
+}
+
+//Unwrap returns ErrNotFound, ErrForbidden or ErrUnreachable.
+func (e *KubeError) Unwrap() error {
+	return e.Cause
+}
+
+//KubeContext is the kubeconfig context the clients are built from.  When empty, the current-context of the kubeconfig is used.
+var KubeContext string
+
+//KubeClients holds the clients used to talk to one cluster.
+type KubeClients struct {
+	Clientset kubernetes.Interface
+	Dynamic   dynamic.Interface
+	Mapper    meta.RESTMapper
+}
+
+var (
+	kubeMu      sync.Mutex
+	kubeClients = make(map[string]*KubeClients)
+)
+
+//kubeUsers holds the identity each cluster authenticates the KubeContext as, reviewed once per run.
+var (
+	userMu    sync.Mutex
+	kubeUsers = make(map[string]string)
+)
+
+//selfSubjectReviewVersions are the versions of the SelfSubjectReview api, newest first.
+var selfSubjectReviewVersions = []string{"v1", "v1beta1", "v1alpha1"}
+
+//Kube returns the clients for a cluster of the kubeconfig, building them on first use.  An empty cluster returns the clients of the KubeContext.
+func Kube(cluster string) (*KubeClients, error) {
+
+	kubeMu.Lock()
+	defer kubeMu.Unlock()
+
+	if clients, ok := kubeClients[cluster]; ok {
+		return clients, nil
+	}
+
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: KubeContext}
+	overrides.Context.Cluster = cluster
+
+	restConfig, err := kubeConfigLoader(overrides).ClientConfig()
+	if err != nil {
+		return nil, &KubeError{ErrUnreachable, "unable to build kubernetes client for cluster [" + cluster + "] -- " + err.Error()}
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, &KubeError{ErrUnreachable, "unable to build kubernetes client for cluster [" + cluster + "] -- " + err.Error()}
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, &KubeError{ErrUnreachable, "unable to build kubernetes client for cluster [" + cluster + "] -- " + err.Error()}
+	}
+
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
+	clients := &KubeClients{
+		Clientset: clientset,
+		Dynamic:   dynamicClient,
+		Mapper:    restmapper.NewShortcutExpander(mapper, clientset.Discovery()),
+	}
+	kubeClients[cluster] = clients
+
+	return clients, nil
+
+}
+
+//SetKube replaces the clients used for a cluster, e.g. with fake clientsets.  An empty cluster sets the clients of the KubeContext.
+func SetKube(cluster string, clients *KubeClients) {
+
+	kubeMu.Lock()
+	defer kubeMu.Unlock()
+
+	kubeClients[cluster] = clients
+
+}
+
+//KubeContextCluster returns the name of the cluster the KubeContext points to.
+func KubeContextCluster() (string, error) {
+
+	rawConfig, err := kubeConfigLoader(&clientcmd.ConfigOverrides{}).RawConfig()
+	if err != nil {
+		return "", errors.New("unable to load kubeconfig -- " + err.Error())
+	}
+
+	contextName := KubeContext
+	if contextName == "" {
+		contextName = rawConfig.CurrentContext
+	}
+
+	kubeContext, ok := rawConfig.Contexts[contextName]
+	if !ok {
+		return "", errors.New("context [" + contextName + "] not found in kubeconfig")
+	}
+
+	return kubeContext.Cluster, nil
+
+}
+
+//KubeContextUser returns the name of the kubeconfig user the KubeContext authenticates as.
+func KubeContextUser() (string, error) {
+
+	rawConfig, err := kubeConfigLoader(&clientcmd.ConfigOverrides{}).RawConfig()
+	if err != nil {
+		return "", errors.New("unable to load kubeconfig -- " + err.Error())
+	}
+
+	contextName := KubeContext
+	if contextName == "" {
+		contextName = rawConfig.CurrentContext
+	}
+
+	kubeContext, ok := rawConfig.Contexts[contextName]
+	if !ok {
+		return "", errors.New("context [" + contextName + "] not found in kubeconfig")
+	}
+
+	return kubeContext.AuthInfo, nil
+
+}
+
+//KubeUser returns the username a cluster authenticates the KubeContext as, from a SelfSubjectReview.  Clusters that do not serve
+//SelfSubjectReviews (before 1.27, or with the api disabled) return the name of the kubeconfig user instead.
+func KubeUser(cluster string) string {
+
+	userMu.Lock()
+	defer userMu.Unlock()
+
+	if user, ok := kubeUsers[cluster]; ok {
+		return user
+	}
+
+	user := reviewedUser(cluster)
+	if user == "" {
+		user, _ = KubeContextUser()
+	}
+	kubeUsers[cluster] = user
+
+	return user
+
+}
+
+//CheckKubeConnection verifies the cluster of the KubeContext can be reached.
+func CheckKubeConnection() error {
+
+	clients, err := Kube("")
+	if err != nil {
+		return err
+	}
+
+	if _, err := clients.Clientset.Discovery().ServerVersion(); err != nil {
+		return kubeError(err, "cluster")
+	}
+
+	return nil
+
+}
+
+//GetObject returns an object of the given kind from the cluster.  kind may be qualified with its api group, e.g. Service.serving.knative.dev.
+func GetObject(cluster string, namespace string, kind string, name string) (map[string]interface{}, error) {
+
+	clients, err := Kube(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	gvr, err := resourceFor(clients, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := clients.Dynamic.Resource(gvr).Namespace(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, kubeError(err, kind+" ["+namespace+"/"+name+"]")
+	}
+
+	return object.Object, nil
+
+}
+
+//ListObjects returns the objects of the given kind in a namespace of the cluster that match the label selector, or every object when it is empty.
+//kind may be qualified with its api group, as for GetObject.
+func ListObjects(cluster string, namespace string, kind string, labelSelector string) ([]map[string]interface{}, error) {
+
+	clients, err := Kube(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	gvr, err := resourceFor(clients, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := clients.Dynamic.Resource(gvr).Namespace(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, kubeError(err, kind+" objects in namespace ["+namespace+"]")
+	}
+
+	var objects []map[string]interface{}
+	for _, item := range list.Items {
+		objects = append(objects, item.Object)
+	}
+
+	return objects, nil
+
+}
+
+//PatchObject applies a json merge patch to an object of the given kind, or to a subresource of it such as status, and returns the patched object.
+func PatchObject(cluster string, namespace string, kind string, name string, patch []byte, subresources ...string) (map[string]interface{}, error) {
+
+	clients, err := Kube(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	gvr, err := resourceFor(clients, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := clients.Dynamic.Resource(gvr).Namespace(namespace).Patch(context.TODO(), name, types.MergePatchType, patch, metav1.PatchOptions{}, subresources...)
+	if err != nil {
+		return nil, kubeError(err, kind+" ["+namespace+"/"+name+"]")
+	}
+
+	return object.Object, nil
+
+}
+
+//reviewedUser creates a SelfSubjectReview in the cluster and returns the username it reports, or an empty string when none is served.
+func reviewedUser(cluster string) string {
+
+	clients, err := Kube(cluster)
+	if err != nil {
+		return ""
+	}
+
+	for _, version := range selfSubjectReviewVersions {
+		gvr := schema.GroupVersionResource{Group: "authentication.k8s.io", Version: version, Resource: "selfsubjectreviews"}
+		review := &unstructured.Unstructured{Object: map[string]interface{}{"apiVersion": gvr.GroupVersion().String(), "kind": "SelfSubjectReview"}}
+		result, err := clients.Dynamic.Resource(gvr).Create(context.TODO(), review, metav1.CreateOptions{})
+		if err != nil {
+			continue
+		}
+		if username, _, _ := unstructured.NestedString(result.Object, "status", "userInfo", "username"); username != "" {
+			return username
+		}
+	}
+
+	return ""
+
+}
+
+//resourceFor resolves a kind, optionally qualified with its version and api group, to the resource served by the cluster.
+func resourceFor(clients *KubeClients, kind string) (schema.GroupVersionResource, error) {
+
+	fullySpecified, groupResource := schema.ParseResourceArg(strings.ToLower(kind))
+	gvr, err := clients.Mapper.ResourceFor(groupResource.WithVersion(""))
+	if fullySpecified != nil {
+		if fullGVR, fullErr := clients.Mapper.ResourceFor(*fullySpecified); fullErr == nil {
+			gvr, err = fullGVR, nil
+		}
+	}
+	if err != nil {
+		return gvr, kubeError(err, "resource type ["+kind+"]")
+	}
+
+	return gvr, nil
+
+}
+
+func kubeConfigLoader(overrides *clientcmd.ConfigOverrides) clientcmd.ClientConfig {
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(clientcmd.NewDefaultClientConfigLoadingRules(), overrides)
+}
+
+//kubeError converts an error returned by the clients into a KubeError describing what happened to the object.
+func kubeError(err error, object string) error {
+
+	switch {
+	case apierrors.IsNotFound(err) || meta.IsNoMatchError(err):
+		return &KubeError{ErrNotFound, object + " not found"}
+	case apierrors.IsForbidden(err) || apierrors.IsUnauthorized(err):
+		return &KubeError{ErrForbidden, "access to " + object + " is forbidden -- " + err.Error()}
+	case apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) || apierrors.IsServiceUnavailable(err):
+		return &KubeError{ErrUnreachable, "unable to reach cluster -- " + err.Error()}
+	}
+
+	if _, ok := err.(apierrors.APIStatus); ok {
+		return err
+	}
+
+	return &KubeError{ErrUnreachable, "unable to reach cluster -- " + err.Error()}
+
+}
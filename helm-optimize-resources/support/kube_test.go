@@ -0,0 +1,256 @@
+package support
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+//setupKube replaces the clients of the KubeContext with fake clients holding the given objects.
+func setupKube(t *testing.T, secrets []runtime.Object, objects []runtime.Object) *fake.Clientset {
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, meta.RESTScopeNamespace)
+
+	clientset := fake.NewSimpleClientset(secrets...)
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	SetKube("", &KubeClients{
+		Clientset: clientset,
+		Dynamic:   dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{deployments: "DeploymentList"}, objects...),
+		Mapper:    mapper,
+	})
+
+	secretNamespace = ""
+	t.Cleanup(func() {
+		kubeMu.Lock()
+		delete(kubeClients, "")
+		kubeMu.Unlock()
+		userMu.Lock()
+		delete(kubeUsers, "")
+		userMu.Unlock()
+	})
+
+	return clientset
+
+}
+
+func pluginSecret(namespace string, data map[string]string) *corev1.Secret {
+
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "helm-optimize-plugin", Namespace: namespace}, Data: map[string][]byte{}}
+	for key, val := range data {
+		secret.Data[key] = []byte(val)
+	}
+
+	return secret
+
+}
+
+func deployment(name string, labels map[string]interface{}) runtime.Object {
+
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": name, "namespace": "default", "labels": labels},
+	}}
+
+}
+
+func TestLocateConfigNamespace(t *testing.T) {
+
+	tests := []struct {
+		name          string
+		secrets       []runtime.Object
+		helmNamespace string
+		want          string
+	}{
+		{"secret in another namespace", []runtime.Object{pluginSecret("tools", nil)}, "default", "tools"},
+		{"no secret", nil, "default", "default"},
+		{"other secrets only", []runtime.Object{&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "tools"}}}, "apps", "apps"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			setupKube(t, test.secrets, nil)
+			os.Setenv("HELM_NAMESPACE", test.helmNamespace)
+			defer os.Unsetenv("HELM_NAMESPACE")
+
+			LocateConfigNamespace("helm-optimize-plugin")
+			if secretNamespace != test.want {
+				t.Errorf("secretNamespace = %s, want %s", secretNamespace, test.want)
+			}
+
+		})
+	}
+
+}
+
+func TestStoreSecrets(t *testing.T) {
+
+	setupKube(t, nil, nil)
+	secretNamespace = "tools"
+
+	if _, err := GetSecret("helm-optimize-plugin"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("GetSecret() error = %v, want ErrNotFound", err)
+	}
+	if secrets := RetrieveSecrets("helm-optimize-plugin"); secrets != nil {
+		t.Fatalf("RetrieveSecrets() = %v, want nil", secrets)
+	}
+
+	if !StoreSecrets("helm-optimize-plugin", map[string]string{"adapter": "AWS Parameter Store", "ssm-prefix": "/optimize"}) {
+		t.Fatal("StoreSecrets() failed to create the secret")
+	}
+	if !StoreSecrets("helm-optimize-plugin", map[string]string{"ssm-prefix": "/team"}) {
+		t.Fatal("StoreSecrets() failed to update the secret")
+	}
+
+	want := map[string]string{"adapter": "AWS Parameter Store", "ssm-prefix": "/team"}
+	if secrets := RetrieveSecrets("helm-optimize-plugin"); !reflect.DeepEqual(secrets, want) {
+		t.Errorf("RetrieveSecrets() = %v, want %v", secrets, want)
+	}
+
+	if err := RemoveSecretData("helm-optimize-plugin", "ssm-prefix"); err != nil {
+		t.Fatalf("RemoveSecretData() error = %v", err)
+	}
+	want = map[string]string{"adapter": "AWS Parameter Store"}
+	if secrets := RetrieveSecrets("helm-optimize-plugin"); !reflect.DeepEqual(secrets, want) {
+		t.Errorf("RetrieveSecrets() after RemoveSecretData = %v, want %v", secrets, want)
+	}
+
+}
+
+func TestGetSecretErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"forbidden", apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "helm-optimize-plugin", errors.New("rbac")), ErrForbidden},
+		{"unauthorized", apierrors.NewUnauthorized("expired token"), ErrForbidden},
+		{"timeout", apierrors.NewTimeoutError("slow", 1), ErrUnreachable},
+		{"not found", apierrors.NewNotFound(schema.GroupResource{Resource: "secrets"}, "helm-optimize-plugin"), ErrNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			clientset := setupKube(t, nil, nil)
+			clientset.PrependReactor("get", "secrets", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, test.err
+			})
+
+			_, err := GetSecret("helm-optimize-plugin")
+			if !errors.Is(err, test.want) {
+				t.Errorf("GetSecret() error = %v, want %v", err, test.want)
+			}
+
+		})
+	}
+
+}
+
+func TestObjects(t *testing.T) {
+
+	setupKube(t, nil, []runtime.Object{
+		deployment("web", map[string]interface{}{"tier": "frontend"}),
+		deployment("db", map[string]interface{}{"tier": "backend"}),
+	})
+
+	object, err := GetObject("", "default", "Deployment", "web")
+	if err != nil {
+		t.Fatalf("GetObject() error = %v", err)
+	}
+	if CheckMap(object, "metadata", "name") != "web" {
+		t.Errorf("GetObject() returned %s, want web", CheckMap(object, "metadata", "name"))
+	}
+
+	if _, err := GetObject("", "default", "deployments.v1.apps", "api"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetObject() of a missing object error = %v, want ErrNotFound", err)
+	}
+	if _, err := GetObject("", "default", "Rollout", "web"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetObject() of an unknown kind error = %v, want ErrNotFound", err)
+	}
+
+	objects, err := ListObjects("", "default", "Deployment", "tier=backend")
+	if err != nil {
+		t.Fatalf("ListObjects() error = %v", err)
+	}
+	if len(objects) != 1 || CheckMap(objects[0], "metadata", "name") != "db" {
+		t.Errorf("ListObjects() = %v, want the db deployment only", objects)
+	}
+
+	patched, err := PatchObject("", "default", "Deployment", "web", []byte(`{"metadata":{"labels":{"tier":"edge"}}}`))
+	if err != nil {
+		t.Fatalf("PatchObject() error = %v", err)
+	}
+	if CheckMap(patched, "metadata", "labels", "tier") != "edge" {
+		t.Errorf("PatchObject() left tier = %s, want edge", CheckMap(patched, "metadata", "labels", "tier"))
+	}
+
+}
+
+func TestKubeUser(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "helm-optimize-kubeconfig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	kubeconfig := filepath.Join(dir, "config")
+	content := "apiVersion: v1\nkind: Config\ncurrent-context: prod\ncontexts:\n- name: prod\n  context: {cluster: prod-cluster, user: ci-deployer}\n"
+	if err := ioutil.WriteFile(kubeconfig, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("KUBECONFIG", kubeconfig)
+	defer os.Unsetenv("KUBECONFIG")
+
+	tests := []struct {
+		name     string
+		versions map[string]string
+		want     string
+	}{
+		{"reviewed", map[string]string{"v1": "jane@example.com"}, "jane@example.com"},
+		{"older review api", map[string]string{"v1beta1": "system:serviceaccount:ci:deployer"}, "system:serviceaccount:ci:deployer"},
+		{"no review api", nil, "ci-deployer"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+
+			setupKube(t, nil, nil)
+			clients, _ := Kube("")
+			clients.Dynamic.(*dynamicfake.FakeDynamicClient).PrependReactor("create", "selfsubjectreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				username, ok := test.versions[action.GetResource().Version]
+				if !ok {
+					return true, nil, apierrors.NewNotFound(action.GetResource().GroupResource(), "")
+				}
+				return true, &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "authentication.k8s.io/" + action.GetResource().Version,
+					"kind":       "SelfSubjectReview",
+					"status":     map[string]interface{}{"userInfo": map[string]interface{}{"username": username}},
+				}}, nil
+			})
+
+			if user := KubeUser(""); user != test.want {
+				t.Errorf("KubeUser() = %s, want %s", user, test.want)
+			}
+
+		})
+	}
+
+}
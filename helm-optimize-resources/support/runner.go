@@ -0,0 +1,121 @@
+package support
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+//Runner executes the external commands (helm and the external adapters) the plugin depends on.
+type Runner interface {
+
+	//Run executes the command, feeding it stdin, and returns its stdout and stderr with the trailing line break removed.
+	Run(command []string, stdin string) (string, string, error)
+}
+
+//CommandRunner is the runner used by ExecuteSingleCommand and ExecuteCommandWithInput.  Replace it through UseRunner, e.g. with a RecordingRunner
+//to replay canned output.
+var CommandRunner Runner = ExecRunner{}
+
+//UseRunner replaces the CommandRunner and returns a function restoring the previous one, e.g. t.Cleanup(support.UseRunner(recorder)).
+func UseRunner(runner Runner) func() {
+
+	previous := CommandRunner
+	CommandRunner = runner
+
+	return func() {
+		CommandRunner = previous
+	}
+
+}
+
+//ExecRunner runs commands on the local machine.
+type ExecRunner struct{}
+
+//Run executes the command with os/exec.
+func (ExecRunner) Run(command []string, stdin string) (string, string, error) {
+
+	if len(command) == 0 {
+		return "", "", errors.New("no command submitted")
+	}
+
+	var stdOut, stdErr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = &stdOut
+	cmd.Stderr = &stdErr
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	err := cmd.Run()
+
+	return strings.TrimSuffix(stdOut.String(), "\n"), strings.TrimSuffix(stdErr.String(), "\n"), err
+
+}
+
+//CommandResponse is the canned output of a command replayed by a RecordingRunner.
+type CommandResponse struct {
+	StdOut string
+	StdErr string
+	Err    error
+}
+
+//RecordingRunner records every command it is asked to run and replays canned responses instead of executing them.
+//Responses are looked up by the command joined with spaces, e.g. "helm template my-release ./my-chart --namespace default".
+//Commands without a response are passed to Fallback, or fail if no fallback is set.
+type RecordingRunner struct {
+	Responses map[string]CommandResponse
+	Fallback  Runner
+
+	mu       sync.Mutex
+	commands [][]string
+	inputs   []string
+}
+
+//NewRecordingRunner returns a RecordingRunner replaying the given responses.
+func NewRecordingRunner(responses map[string]CommandResponse) *RecordingRunner {
+	return &RecordingRunner{Responses: responses}
+}
+
+//Run records the command and returns its canned response.
+func (r *RecordingRunner) Run(command []string, stdin string) (string, string, error) {
+
+	r.mu.Lock()
+	r.commands = append(r.commands, append([]string(nil), command...))
+	r.inputs = append(r.inputs, stdin)
+	response, ok := r.Responses[strings.Join(command, " ")]
+	r.mu.Unlock()
+
+	if ok {
+		return response.StdOut, response.StdErr, response.Err
+	}
+
+	if r.Fallback != nil {
+		return r.Fallback.Run(command, stdin)
+	}
+
+	return "", "no canned response", errors.New("no canned response for command [" + strings.Join(command, " ") + "]")
+
+}
+
+//Commands returns the commands run so far, in order.
+func (r *RecordingRunner) Commands() [][]string {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([][]string(nil), r.commands...)
+
+}
+
+//Inputs returns the stdin passed to each command run so far, in the same order as Commands.
+func (r *RecordingRunner) Inputs() []string {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.inputs...)
+
+}
@@ -0,0 +1,275 @@
+package support
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+//NonInteractive disables every prompt.  Values that are not supplied as a flag, environment variable or in the config file fail instead of blocking on stdin.
+var NonInteractive = false
+
+//Configuring is set while the adapter is configured with helm optimize -c --adapter.  Settings supplied over a stored configuration are only
+//persisted while configuring, so a single run with an override does not change the configuration of every user of the cluster.
+var Configuring = false
+
+var registeredSettings = map[string]bool{}
+var boolSettings = map[string]bool{"non-interactive": true}
+var flagSettings = map[string]string{}
+var fileSettings = map[string]string{}
+
+//RegisterSetting makes a setting available as the flag --<key>=<value> and the environment variable HELM_OPTIMIZE_<KEY>.
+func RegisterSetting(key string) {
+	registeredSettings[key] = true
+}
+
+//RegisterBoolSetting makes a switch available as the flag --<key>, which may also be given as --<key>=true|false, and the environment variable HELM_OPTIMIZE_<KEY>.
+func RegisterBoolSetting(key string) {
+	registeredSettings[key] = true
+	boolSettings[key] = true
+}
+
+//SettingEnvVar returns the environment variable a setting is read from.
+func SettingEnvVar(key string) string {
+	return "HELM_OPTIMIZE_" + strings.ToUpper(strings.Replace(key, "-", "_", -1))
+}
+
+//ParseSettings strips the plugin flags from args, loads the config file and returns the arguments that are meant for helm.
+func ParseSettings(args []string) ([]string, error) {
+
+	var helmArgs []string
+	configFile := os.Getenv("HELM_OPTIMIZE_CONFIG")
+
+	for i := 0; i < len(args); i++ {
+
+		if !strings.HasPrefix(args[i], "--") {
+			helmArgs = append(helmArgs, args[i])
+			continue
+		}
+
+		key := strings.TrimPrefix(args[i], "--")
+		value := ""
+		hasValue := false
+		if pos := strings.Index(key, "="); pos > -1 {
+			key, value, hasValue = key[:pos], key[pos+1:], true
+		}
+
+		if boolSettings[key] {
+			if !hasValue {
+				value = "true"
+			}
+			flagSettings[key] = value
+			continue
+		}
+
+		if key != "optimize-config" && !registeredSettings[key] {
+			helmArgs = append(helmArgs, args[i])
+			continue
+		}
+
+		//a plugin flag without a value is left alone, so sub-options like '-c --adapter' keep working
+		if !hasValue {
+			if i+1 >= len(args) || strings.HasPrefix(args[i+1], "-") {
+				helmArgs = append(helmArgs, args[i])
+				continue
+			}
+			i++
+			value = args[i]
+		}
+
+		if key == "optimize-config" {
+			configFile = value
+		} else {
+			flagSettings[key] = value
+		}
+
+	}
+
+	if configFile != "" {
+		if err := loadSettingsFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	nonInteractive, err := BoolSetting("non-interactive")
+	if err != nil {
+		return nil, err
+	}
+	NonInteractive = nonInteractive
+
+	return helmArgs, nil
+
+}
+
+//Setting looks up a setting from the command line flags, then the environment, then the config file.
+func Setting(key string) (string, bool) {
+
+	if val, ok := flagSettings[key]; ok {
+		return val, true
+	}
+
+	if val, ok := os.LookupEnv(SettingEnvVar(key)); ok {
+		return val, true
+	}
+
+	if val, ok := fileSettings[key]; ok {
+		return val, true
+	}
+
+	return "", false
+
+}
+
+//BoolSetting looks up a switch registered with RegisterBoolSetting.  It is false unless set.
+func BoolSetting(key string) (bool, error) {
+
+	val, ok := Setting(key)
+	if !ok {
+		return false, nil
+	}
+
+	enabled, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, errors.New("invalid value [" + val + "] for setting " + key)
+	}
+
+	return enabled, nil
+
+}
+
+//SettingMap looks up a setting holding a list of key=value pairs, e.g. --workload-kinds=Rollout={.spec.template.spec.containers},ScaledJob=...
+//In the config file the setting may also be written as a yaml map.
+func SettingMap(key string) (map[string]string, bool, error) {
+
+	val, ok := Setting(key)
+	if !ok || val == "" {
+		return nil, false, nil
+	}
+
+	settingMap := make(map[string]string)
+	for _, pair := range strings.Split(val, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, true, errors.New("invalid value [" + pair + "] for setting " + key + " -- expected key=value pairs separated by commas")
+		}
+		settingMap[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+
+	return settingMap, true, nil
+
+}
+
+//CanPrompt returns true when the value for the setting has to come from the user and the user can be asked for it.
+func CanPrompt(key string) bool {
+
+	if _, ok := Setting(key); ok {
+		return false
+	}
+
+	return !NonInteractive
+
+}
+
+//MissingSettingError returns the error reported when a required setting is not available in non-interactive mode.
+func MissingSettingError(key string) error {
+	return errors.New("missing required setting [" + key + "] -- provide --" + key + "=<value>, set " + SettingEnvVar(key) + " or add '" + key + "' to the config file")
+}
+
+//Prompt returns the value of a setting, asking the user for it if it has not been supplied.
+func Prompt(key string, label string) (string, error) {
+
+	if val, ok := Setting(key); ok {
+		return val, nil
+	}
+
+	if NonInteractive {
+		return "", MissingSettingError(key)
+	}
+
+	var val string
+	fmt.Print(label)
+	fmt.Scanln(&val)
+
+	return val, nil
+
+}
+
+//PromptDefault behaves like Prompt, but falls back to defaultValue when the user or the configuration leaves the setting empty.  In non-interactive
+//mode defaultValue is returned without an error, so it is only meant for settings whose default is safe to apply unattended.
+func PromptDefault(key string, label string, defaultValue string) string {
+
+	if val, ok := Setting(key); ok {
+		return val
+	}
+
+	if NonInteractive {
+		return defaultValue
+	}
+
+	var val string
+	fmt.Print(label)
+	fmt.Scanln(&val)
+	if val == "" {
+		return defaultValue
+	}
+
+	return val
+
+}
+
+//PromptPassword behaves like Prompt, without echoing the value typed by the user.
+func PromptPassword(key string, label string) (string, error) {
+
+	if val, ok := Setting(key); ok {
+		return val, nil
+	}
+
+	if NonInteractive {
+		return "", MissingSettingError(key)
+	}
+
+	fmt.Print(label)
+	pass, _ := terminal.ReadPassword(0)
+	fmt.Println("")
+
+	return string(pass), nil
+
+}
+
+func loadSettingsFile(path string) error {
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.New("unable to read config file [" + path + "]")
+	}
+
+	var settings map[string]interface{}
+	if err := yaml.Unmarshal(content, &settings); err != nil {
+		return errors.New("config file [" + path + "] is not valid yaml or json")
+	}
+
+	for key, val := range settings {
+		switch typedVal := val.(type) {
+		case nil:
+		case map[string]interface{}:
+			var pairs []string
+			for mapKey, mapVal := range typedVal {
+				pairs = append(pairs, mapKey+"="+fmt.Sprint(mapVal))
+			}
+			sort.Strings(pairs)
+			fileSettings[key] = strings.Join(pairs, ",")
+		default:
+			fileSettings[key] = fmt.Sprint(val)
+		}
+	}
+
+	return nil
+
+}
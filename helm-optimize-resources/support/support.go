@@ -1,49 +1,46 @@
 package support
 
 import (
-	"bufio"
 	"bytes"
+	"context"
 	"encoding/base64"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/magiconair/properties"
 	"golang.org/x/crypto/ssh/terminal"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 //Config holds the configMap from the data forwarder
 var Config *properties.Properties = nil
 
-//KubectlBin holds location of kubectl
-var KubectlBin = "kubectl"
-
 var secretNamespace string
 
 //LoadConfigMap loads the config map from the densify forwarder
 func LoadConfigMap() {
 
-	var stdOut, stdErr string
-	var err error
-	if stdOut, stdErr, err = ExecuteSingleCommand([]string{KubectlBin, "get", "configmaps", "-A", "-o", "json"}); err != nil {
-		fmt.Println(stdErr)
+	clients, err := Kube("")
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	var configMaps map[string]interface{}
-	if err := json.Unmarshal([]byte(stdOut), &configMaps); err != nil {
-		fmt.Println(err)
+	configMaps, err := clients.Clientset.CoreV1().ConfigMaps("").List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		fmt.Println(kubeError(err, "configmaps"))
 		return
 	}
 
-	for _, configMap := range configMaps["items"].([]interface{}) {
-		if val, ok := configMap.(map[string]interface{})["data"].(map[string]interface{})["config.properties"]; ok && strings.Contains(val.(string), "Densify Inc. D/B/A Densify #  All Rights Reserved.") {
-			Config = properties.MustLoadString(val.(string))
+	for _, configMap := range configMaps.Items {
+		if val, ok := configMap.Data["config.properties"]; ok && strings.Contains(val, "Densify Inc. D/B/A Densify #  All Rights Reserved.") {
+			Config = properties.MustLoadString(val)
 			return
 		}
 	}
@@ -68,31 +65,37 @@ func CheckError(message string, err error, exit bool) bool {
 //LocateConfigNamespace will identify which namespace the configuration secret is stored.
 func LocateConfigNamespace(secretName string) {
 
-	cmd := exec.Command(KubectlBin, "get", "secrets", "-o", "json", "--all-namespaces")
-	out, err := cmd.CombinedOutput()
+	secretNamespace = os.Getenv("HELM_NAMESPACE")
+
+	clients, err := Kube("")
 	if err != nil {
-		secretNamespace = ""
+		return
 	}
 
-	var secretsMapEncoded map[string]interface{}
-	json.Unmarshal(out, &secretsMapEncoded)
+	secrets, err := clients.Clientset.CoreV1().Secrets("").List(context.TODO(), metav1.ListOptions{FieldSelector: "metadata.name=" + secretName})
+	if err != nil {
+		return
+	}
 
-	for _, val := range secretsMapEncoded["items"].([]interface{}) {
-		name := val.(map[string]interface{})["metadata"].(map[string]interface{})["name"]
-		if name == secretName {
-			secretNamespace = val.(map[string]interface{})["metadata"].(map[string]interface{})["namespace"].(string)
+	for _, secret := range secrets.Items {
+		if secret.Name == secretName {
+			secretNamespace = secret.Namespace
 			return
 		}
-
 	}
 
-	secretNamespace = os.Getenv("HELM_NAMESPACE")
-
 }
 
 //DeleteSecret deletes the specified k8s secret
 func DeleteSecret(secretName string) {
-	_, _, _ = ExecuteSingleCommand([]string{KubectlBin, "delete", "secret", secretName, "--namespace", secretNamespace, "--ignore-not-found"})
+
+	clients, err := Kube("")
+	if err != nil {
+		return
+	}
+
+	_ = clients.Clientset.CoreV1().Secrets(secretNamespace).Delete(context.TODO(), secretName, metav1.DeleteOptions{})
+
 }
 
 //RemoveSecretData deletes the specified k8s secret
@@ -115,90 +118,80 @@ func RemoveSecretData(secretName string, secretKey string) error {
 //StoreSecrets stores the specified k8s secret
 func StoreSecrets(secretName string, secrets map[string]string) bool {
 
-	existingSecrets := RetrieveSecrets(secretName)
-	if existingSecrets == nil {
-		existingSecrets = make(map[string]string)
+	clients, err := Kube("")
+	if err != nil {
+		return false
 	}
 
-	for key, val := range secrets {
-		existingSecrets[key] = val
+	secretClient := clients.Clientset.CoreV1().Secrets(secretNamespace)
+	secret, err := secretClient.Get(context.TODO(), secretName, metav1.GetOptions{})
+	exists := err == nil
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return false
+		}
+		secret = &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: secretNamespace}, Type: corev1.SecretTypeOpaque}
 	}
 
-	createCmd := []string{KubectlBin, "create", "secret", "generic", secretName, "--namespace", secretNamespace}
-	for key, val := range existingSecrets {
-		createCmd = append(createCmd, "--from-literal="+key+"="+val)
+	if secret.Data == nil {
+		secret.Data = make(map[string][]byte)
+	}
+	for key, val := range secrets {
+		secret.Data[key] = []byte(val)
 	}
 
-	DeleteSecret(secretName)
-	_, _, err := ExecuteSingleCommand(createCmd)
-	if err != nil {
-		return false
+	if exists {
+		_, err = secretClient.Update(context.TODO(), secret, metav1.UpdateOptions{})
+	} else {
+		_, err = secretClient.Create(context.TODO(), secret, metav1.CreateOptions{})
 	}
 
-	return true
+	return err == nil
 
 }
 
-//RetrieveSecrets will retreive the specified secret
+//RetrieveSecrets will retreive the specified secret.  nil is returned if the secret cannot be read.
 func RetrieveSecrets(secretName string) map[string]string {
 
-	stdOut, _, err := ExecuteSingleCommand([]string{KubectlBin, "get", "secret", secretName, "--namespace", secretNamespace, "-o", "jsonpath={.data}"})
+	secrets, err := GetSecret(secretName)
 	if err != nil {
 		return nil
 	}
 
-	var secretsMapEncoded map[string]string
-	json.Unmarshal([]byte(stdOut), &secretsMapEncoded)
-
-	secretsMapDecoded := make(map[string]string)
-	for key, encodedVal := range secretsMapEncoded {
-		decodedVal, _ := base64.StdEncoding.DecodeString(encodedVal)
-		secretsMapDecoded[key] = string(decodedVal)
-	}
-
-	return secretsMapDecoded
+	return secrets
 
 }
 
-//ExecuteSingleCommand this function executes a given command.
-func ExecuteSingleCommand(command []string) (string, string, error) {
+//GetSecret returns the decoded data of the specified secret.  The error is a KubeError.
+func GetSecret(secretName string) (map[string]string, error) {
 
-	var cmd *exec.Cmd
-	if len(command) == 1 {
-		cmd = exec.Command(command[0])
-	} else if len(command) > 1 {
-		cmd = exec.Command(command[0], command[1:]...)
-	} else {
-		return "", "", errors.New("no command submitted")
+	clients, err := Kube("")
+	if err != nil {
+		return nil, err
 	}
 
-	stderr, _ := cmd.StderrPipe()
-	stdout, _ := cmd.StdoutPipe()
-
-	err := cmd.Start()
-
-	scannerErr := bufio.NewScanner(stderr)
-	errStr := ""
-	for scannerErr.Scan() {
-		errStr += scannerErr.Text() + "\n"
+	secret, err := clients.Clientset.CoreV1().Secrets(secretNamespace).Get(context.TODO(), secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, kubeError(err, "secret ["+secretNamespace+"/"+secretName+"]")
 	}
 
-	scannerOut := bufio.NewScanner(stdout)
-	outStr := ""
-	for scannerOut.Scan() {
-		outStr += scannerOut.Text() + "\n"
+	secretsMapDecoded := make(map[string]string)
+	for key, val := range secret.Data {
+		secretsMapDecoded[key] = string(val)
 	}
 
-	if len(outStr) > 0 {
-		outStr = outStr[:len(outStr)-1]
-	}
-	if len(errStr) > 0 {
-		errStr = errStr[:len(errStr)-1]
-	}
+	return secretsMapDecoded, nil
 
-	err = cmd.Wait()
-	return outStr, errStr, err
+}
 
+//ExecuteSingleCommand this function executes a given command through the CommandRunner.
+func ExecuteSingleCommand(command []string) (string, string, error) {
+	return CommandRunner.Run(command, "")
+}
+
+//ExecuteCommandWithInput executes a given command through the CommandRunner, writing input to its stdin.
+func ExecuteCommandWithInput(command []string, input string) (string, string, error) {
+	return CommandRunner.Run(command, input)
 }
 
 //FileExists will check if a file (not directory) exists in the specified path.
@@ -265,6 +258,27 @@ func CheckMap(inputMap map[string]interface{}, list ...string) string {
 
 }
 
+//JSONPathValue returns the value found at a simple jsonpath (e.g. {.spec.template.spec.containers}) in an unmarshalled object.
+func JSONPathValue(inputMap map[string]interface{}, jsonPath string) (interface{}, bool) {
+
+	jsonPath = strings.TrimSuffix(strings.TrimPrefix(jsonPath, "{"), "}")
+	jsonPath = strings.TrimPrefix(jsonPath, ".")
+
+	var val interface{} = inputMap
+	for _, key := range strings.Split(jsonPath, ".") {
+		valMap, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if val, ok = valMap[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return val, true
+
+}
+
 func PrintCharAcrossScreen(char string) {
 	if width, _, err := terminal.GetSize(0); err != nil {
 		fmt.Println(strings.Repeat(char, 100))
@@ -304,12 +318,16 @@ func DeleteFile(filepath string) error {
 
 }
 
-//HTTPRequest send a REST api request to an end point
+//HTTPRequest send a REST api request to an end point.  authStr is sent as basic auth, unless it is empty.
 func HTTPRequest(method string, endpoint string, authStr string, body []byte) (string, error) {
 
-	auth := base64.StdEncoding.EncodeToString([]byte(authStr))
-	req, _ := http.NewRequest(method, endpoint, bytes.NewBuffer(body))
-	req.Header.Add("Authorization", "Basic "+auth)
+	req, err := http.NewRequest(method, endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return "", err
+	}
+	if authStr != "" {
+		req.Header.Add("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(authStr)))
+	}
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
 	client := &http.Client{}
@@ -0,0 +1,386 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//Name is the name the Vault adapter is registered and stored under.
+const Name = "Vault"
+
+var (
+	vaultAddr      string
+	token          string
+	mount          = "secret"
+	prefix         string
+	vaultNamespace string
+
+	//storedToken is the token kept with the configuration, only ever one entered at the prompt
+	storedToken string
+)
+
+//errNotFound is returned by vaultRequest when the path does not exist.
+var errNotFound = errors.New("not found")
+
+type adapter struct{}
+
+func init() {
+	adapters.Register(adapter{})
+	support.RegisterSetting("vault-addr")
+	support.RegisterSetting("vault-token")
+	support.RegisterSetting("vault-mount")
+	support.RegisterSetting("vault-prefix")
+	support.RegisterSetting("vault-namespace")
+}
+
+////////////////////////////////////////////////////////
+////////////////EXTERNAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//Name returns the name of the adapter
+func (adapter) Name() string {
+	return Name
+}
+
+//Initialize will ready the adapter to serve insights from a Vault KV v2 mount.
+func (adapter) Initialize() error {
+
+	//use the stored configuration, with each setting that is supplied taking precedence over its stored value
+	storedSecrets := support.RetrieveSecrets("helm-optimize-plugin")
+	if storedSecrets != nil && storedSecrets["adapter"] == Name {
+		if _, ok := storedSecrets["vaultAddr"]; ok {
+			vaultAddr = storedSecrets["vaultAddr"]
+			token = storedSecrets["vaultToken"]
+			storedToken = token
+			mount = storedSecrets["mount"]
+			prefix = storedSecrets["prefix"]
+			vaultNamespace = storedSecrets["namespace"]
+			for key, value := range map[string]*string{"vault-addr": &vaultAddr, "vault-token": &token, "vault-mount": &mount, "vault-prefix": &prefix, "vault-namespace": &vaultNamespace} {
+				if val, ok := support.Setting(key); ok {
+					*value = val
+				}
+			}
+			vaultAddr = strings.TrimSuffix(vaultAddr, "/")
+			mount = strings.Trim(mount, "/")
+			prefix = strings.Trim(prefix, "/")
+			if token == "" {
+				token = os.Getenv("VAULT_TOKEN")
+			}
+			if err := validateSecrets(); err == nil {
+				if support.Configuring {
+					storeSecrets()
+				}
+				return nil
+			}
+		}
+	}
+
+	defaultAddr := os.Getenv("VAULT_ADDR")
+	if defaultAddr == "" {
+		defaultAddr = "http://127.0.0.1:8200"
+	}
+	vaultAddr = strings.TrimSuffix(support.PromptDefault("vault-addr", "Enter Vault address ["+defaultAddr+"]: ", defaultAddr), "/")
+
+	mount = strings.Trim(support.PromptDefault("vault-mount", "Enter KV v2 mount [secret]: ", "secret"), "/")
+	prefix = strings.Trim(support.PromptDefault("vault-prefix", "What is your preferred key prefix [no prefix]: ", ""), "/")
+	vaultNamespace = support.PromptDefault("vault-namespace", "Enter Vault namespace [none]: ", os.Getenv("VAULT_NAMESPACE"))
+
+	//a token from $VAULT_TOKEN or the vault-token setting is used for this run only, and never stored
+	_, explicitToken := support.Setting("vault-token")
+	for {
+		var err error
+		storedToken = ""
+		if !explicitToken && os.Getenv("VAULT_TOKEN") != "" {
+			token = os.Getenv("VAULT_TOKEN")
+		} else if token, err = support.PromptPassword("vault-token", "Enter Vault Token: "); err != nil {
+			return err
+		} else if !explicitToken {
+			storedToken = token
+		}
+		if err := validateSecrets(); err != nil {
+			if !support.CanPrompt("vault-token") || os.Getenv("VAULT_TOKEN") != "" {
+				return err
+			}
+			fmt.Println(err)
+			continue
+		}
+		break
+	}
+
+	if support.Configuring {
+		storeSecrets()
+	}
+
+	return nil
+
+}
+
+//GetInsight gets an insight from vault based on the keys cluster, namespace, objType, objName and containerName
+func (adapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+
+	resp, err := vaultRequest("GET", "/v1/"+mount+"/data/"+secretPath(cluster, namespace, objType, objName, containerName), nil)
+	if err != nil {
+		return nil, "", errors.New("could not locate resource spec")
+	}
+
+	data, _ := support.JSONPathValue(resp, "{.data.data}")
+	dataMap, _ := data.(map[string]interface{})
+
+	insightObj := map[string]map[string]string{}
+	for _, section := range []string{"limits", "requests"} {
+		resources, err := sectionResources(dataMap[section])
+		if err != nil {
+			return nil, "", err
+		}
+		if len(resources) == 0 {
+			continue
+		}
+		insightObj[section] = map[string]string{}
+		for resource, val := range resources {
+			canonical, err := quantity.ResourceSpec(resource, fmt.Sprint(val))
+			if err != nil {
+				return nil, "", errors.New("invalid resource specs received from repository -- " + err.Error())
+			}
+			insightObj[section][resource] = canonical
+		}
+	}
+	if len(insightObj) == 0 {
+		return nil, "", errors.New("invalid resource specs received from repository")
+	}
+
+	//Acquire approval setting
+	approval, _ := support.JSONPathValue(resp, "{.data.metadata.custom_metadata.approval}")
+	approvalSetting, ok := approval.(string)
+	if !ok || approvalSetting == "" {
+		return nil, "", errors.New("unable to read approval setting")
+	}
+
+	return insightObj, approvalLabel(approvalSetting), nil
+
+}
+
+//UpdateApprovalSetting will write a new version of the secret with the recommended or current resources, and record the approval in its metadata
+func (adapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+
+	path := secretPath(cluster, namespace, objType, objName, containerName)
+
+	customMetadata, err := readCustomMetadata(path)
+	if err != nil {
+		return errors.New("unable to update approval setting")
+	}
+
+	//custom metadata is named <current|recommended>:<limits|requests>:<resource>, as the tags of the Parameter Store adapter
+	settings := map[string]map[string]map[string]string{
+		"current":     {"limits": {}, "requests": {}},
+		"recommended": {"limits": {}, "requests": {}},
+	}
+	for key, val := range customMetadata {
+		parts := strings.SplitN(key, ":", 3)
+		if len(parts) != 3 || settings[parts[0]] == nil || settings[parts[0]][parts[1]] == nil {
+			continue
+		}
+		settings[parts[0]][parts[1]][parts[2]] = val
+	}
+
+	recorded, label := "current", "NotApproved"
+	if approved {
+		recorded, label = "recommended", "Approved"
+	}
+	resources := settings[recorded]
+	if len(resources["limits"])+len(resources["requests"]) == 0 {
+		return errors.New("unable to update approval setting -- no " + recorded + " resources are recorded in the secret metadata")
+	}
+
+	//the values are written with their units, so bare numbers keep their meaning of millicores and MiB
+	for section, values := range resources {
+		for resource, val := range values {
+			canonical, err := quantity.ResourceSpec(resource, val)
+			if err != nil {
+				return errors.New("unable to update approval setting -- invalid value for " + recorded + ":" + section + ":" + resource + " -- " + err.Error())
+			}
+			values[resource] = canonical
+		}
+	}
+
+	if _, err := vaultRequest("POST", "/v1/"+mount+"/data/"+path, map[string]interface{}{"data": resources}); err != nil {
+		return errors.New("unable to update approval setting")
+	}
+
+	customMetadata["approval"] = label
+	if _, err := vaultRequest("POST", "/v1/"+mount+"/metadata/"+path, map[string]interface{}{"custom_metadata": customMetadata}); err != nil {
+		return errors.New("unable to update approval setting")
+	}
+
+	return nil
+
+}
+
+//GetApprovalSetting will acquire the current approval setting
+func (adapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+
+	customMetadata, err := readCustomMetadata(secretPath(cluster, namespace, objType, objName, containerName))
+	if err != nil || customMetadata["approval"] == "" {
+		return "", errors.New("unable to read approval setting")
+	}
+
+	return approvalLabel(customMetadata["approval"]), nil
+
+}
+
+////////////////////////////////////////////////////////
+///////////////////LOCAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//secretPath returns the path of a resource spec within the mount, laid out as the parameters of the Parameter Store adapter.
+func secretPath(cluster string, namespace string, objType string, objName string, containerName string) string {
+
+	path := cluster + "/" + namespace + "/" + objType + "/" + objName + "/" + containerName + "/resourceSpec"
+	if prefix != "" {
+		path = prefix + "/" + path
+	}
+
+	return path
+
+}
+
+//sectionResources reads the limits or requests of a secret.  Each is a map, or a JSON string as written by vault kv put <path> limits='{...}'.
+func sectionResources(val interface{}) (map[string]interface{}, error) {
+
+	switch typed := val.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return typed, nil
+	case string:
+		var resources map[string]interface{}
+		if err := json.Unmarshal([]byte(typed), &resources); err != nil {
+			return nil, errors.New("invalid resource specs received from repository")
+		}
+		return resources, nil
+	}
+
+	return nil, errors.New("invalid resource specs received from repository")
+
+}
+
+//approvalLabel converts the approval recorded in the metadata to the approval setting shown to the user.
+func approvalLabel(label string) string {
+
+	if label == "NotApproved" {
+		return "Not Approved"
+	}
+
+	return label
+
+}
+
+func readCustomMetadata(path string) (map[string]string, error) {
+
+	resp, err := vaultRequest("GET", "/v1/"+mount+"/metadata/"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	customMetadata := make(map[string]string)
+	val, _ := support.JSONPathValue(resp, "{.data.custom_metadata}")
+	if valMap, ok := val.(map[string]interface{}); ok {
+		for key, value := range valMap {
+			customMetadata[key] = fmt.Sprint(value)
+		}
+	}
+
+	return customMetadata, nil
+
+}
+
+//vaultRequest sends a request to the vault api and returns the decoded response.  A missing path returns errNotFound.
+func vaultRequest(method string, path string, body interface{}) (map[string]interface{}, error) {
+
+	var reader io.Reader
+	if body != nil {
+		content, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(content)
+	}
+
+	req, err := http.NewRequest(method, vaultAddr+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("X-Vault-Token", token)
+	if vaultNamespace != "" {
+		req.Header.Add("X-Vault-Namespace", vaultNamespace)
+	}
+	if body != nil {
+		req.Header.Add("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+	content, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errNotFound
+	}
+
+	if resp.StatusCode >= 300 {
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(content, &errResp)
+		return nil, errors.New("vault request failed with status " + resp.Status + " -- " + strings.Join(errResp.Errors, "; "))
+	}
+
+	parsedResp := make(map[string]interface{})
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &parsedResp); err != nil {
+			return nil, errors.New("unable to parse vault response")
+		}
+	}
+
+	return parsedResp, nil
+
+}
+
+func validateSecrets() error {
+
+	if _, err := vaultRequest("GET", "/v1/auth/token/lookup-self", nil); err != nil {
+		return errors.New("unable to authenticate with vault at [" + vaultAddr + "] -- " + err.Error())
+	}
+
+	return nil
+
+}
+
+func storeSecrets() {
+
+	secrets := make(map[string]string)
+	secrets["adapter"] = Name
+	secrets["vaultAddr"] = vaultAddr
+	secrets["vaultToken"] = storedToken
+	secrets["mount"] = mount
+	secrets["prefix"] = prefix
+	secrets["namespace"] = vaultNamespace
+	support.StoreSecrets("helm-optimize-plugin", secrets)
+
+}
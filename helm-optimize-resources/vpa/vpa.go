@@ -0,0 +1,299 @@
+package vpa
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/densify-quick-start/helm-optimize-resources/adapters"
+	"github.com/densify-quick-start/helm-optimize-resources/quantity"
+	"github.com/densify-quick-start/helm-optimize-resources/support"
+)
+
+//Name is the name the VerticalPodAutoscaler adapter is registered and stored under.
+const Name = "VerticalPodAutoscaler"
+
+//vpaKind is the kind looked up in the remote cluster.
+const vpaKind = "VerticalPodAutoscaler.autoscaling.k8s.io"
+
+var (
+	requestBound = "target"
+	limitBound   = "upperBound"
+	headroom     float64
+)
+
+//bounds are the recommendations of a VPA that can be mapped to requests or limits.
+var bounds = []string{"target", "lowerBound", "upperBound", "uncappedTarget"}
+
+//namespaceLookup holds the VPAs of a namespace, listed at most once.
+type namespaceLookup struct {
+	once sync.Once
+	vpas []map[string]interface{}
+	err  error
+}
+
+//vpaCache holds the VPAs of each cluster/namespace, listed once per run.
+var (
+	cacheMu  sync.Mutex
+	vpaCache = make(map[string]*namespaceLookup)
+)
+
+type adapter struct{}
+
+func init() {
+	adapters.Register(adapter{})
+	support.RegisterSetting("vpa-request-bound")
+	support.RegisterSetting("vpa-limit-bound")
+	support.RegisterSetting("vpa-headroom")
+}
+
+////////////////////////////////////////////////////////
+////////////////EXTERNAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//Name returns the name of the adapter
+func (adapter) Name() string {
+	return Name
+}
+
+//Initialize will read which VPA recommendations are mapped to requests and limits, and the headroom added to them.
+func (adapter) Initialize() error {
+
+	//use the stored mapping, with each setting that is supplied taking precedence over its stored value
+	storedSecrets := support.RetrieveSecrets("helm-optimize-plugin")
+	if storedSecrets != nil && storedSecrets["adapter"] == Name {
+		if _, ok := storedSecrets["requestBound"]; ok {
+			requestBound = storedSecrets["requestBound"]
+			limitBound = storedSecrets["limitBound"]
+			storedHeadroom := storedSecrets["headroom"]
+			for key, value := range map[string]*string{"vpa-request-bound": &requestBound, "vpa-limit-bound": &limitBound, "vpa-headroom": &storedHeadroom} {
+				if val, ok := support.Setting(key); ok {
+					*value = val
+				}
+			}
+			if err := validateBound("vpa-request-bound", requestBound, false); err != nil {
+				return err
+			}
+			if err := validateBound("vpa-limit-bound", limitBound, true); err != nil {
+				return err
+			}
+			percent, err := parseHeadroom(storedHeadroom)
+			if err != nil {
+				return err
+			}
+			headroom = percent
+			if support.Configuring {
+				storeSecrets()
+			}
+			return nil
+		}
+	}
+
+	for {
+		requestBound = support.PromptDefault("vpa-request-bound", "Which VPA recommendation should set requests ("+strings.Join(bounds, "/")+") [target]: ", "target")
+		if err := validateBound("vpa-request-bound", requestBound, false); err != nil {
+			if !support.CanPrompt("vpa-request-bound") {
+				return err
+			}
+			fmt.Println("Invalid entry.  Use one of " + strings.Join(bounds, ", ") + ".")
+			continue
+		}
+		break
+	}
+
+	for {
+		limitBound = support.PromptDefault("vpa-limit-bound", "Which VPA recommendation should set limits ("+strings.Join(bounds, "/")+"/none) [upperBound]: ", "upperBound")
+		if err := validateBound("vpa-limit-bound", limitBound, true); err != nil {
+			if !support.CanPrompt("vpa-limit-bound") {
+				return err
+			}
+			fmt.Println("Invalid entry.  Use one of " + strings.Join(bounds, ", ") + " or none.")
+			continue
+		}
+		break
+	}
+
+	for {
+		percent, err := parseHeadroom(support.PromptDefault("vpa-headroom", "What headroom should be added to the recommendations, in percent [0]: ", "0"))
+		if err != nil {
+			if !support.CanPrompt("vpa-headroom") {
+				return err
+			}
+			fmt.Println("Invalid entry.  Use a percentage of 0 or more.")
+			continue
+		}
+		headroom = percent
+		break
+	}
+
+	if support.Configuring {
+		storeSecrets()
+	}
+
+	return nil
+
+}
+
+//GetInsight gets an insight from the VPA targeting the objType/objName, based on the keys cluster, namespace, objType, objName and containerName
+func (adapter) GetInsight(cluster string, namespace string, objType string, objName string, containerName string) (map[string]map[string]string, string, error) {
+
+	vpa, err := lookupVPA(cluster, namespace, objType, objName)
+	if err != nil {
+		return nil, "", err
+	}
+
+	recommendations, _ := support.JSONPathValue(vpa, "{.status.recommendation.containerRecommendations}")
+	recommendationList, _ := recommendations.([]interface{})
+
+	for _, recommendation := range recommendationList {
+		recommendationMap, ok := recommendation.(map[string]interface{})
+		if !ok || recommendationMap["containerName"] != containerName {
+			continue
+		}
+
+		insightObj := map[string]map[string]string{}
+		for section, bound := range map[string]string{"requests": requestBound, "limits": limitBound} {
+			if bound == "none" {
+				continue
+			}
+			values, ok := recommendationMap[bound].(map[string]interface{})
+			if !ok || len(values) == 0 {
+				return nil, "", errors.New("VerticalPodAutoscaler has no " + bound + " recommendation for container [" + containerName + "]")
+			}
+			insightObj[section] = map[string]string{}
+			for resource, val := range values {
+				withHeadroom, err := addHeadroom(resource, fmt.Sprint(val))
+				if err != nil {
+					return nil, "", errors.New("invalid resource specs received from repository -- " + err.Error())
+				}
+				insightObj[section][resource] = withHeadroom
+			}
+		}
+
+		//VPA recommendations are not approved, they are always applied
+		return insightObj, "Approved", nil
+	}
+
+	return nil, "", errors.New("VerticalPodAutoscaler has no recommendation for container [" + containerName + "]")
+
+}
+
+//UpdateApprovalSetting is not supported, as VPA recommendations are always applied
+func (adapter) UpdateApprovalSetting(approved bool, cluster string, namespace string, objType string, objName string, containerName string) error {
+	return errors.New("approval settings are not supported by the " + Name + " adapter")
+}
+
+//GetApprovalSetting is not supported, as VPA recommendations are always applied
+func (adapter) GetApprovalSetting(cluster string, namespace string, objType string, objName string, containerName string) (string, error) {
+	return "", errors.New("approval settings are not supported by the " + Name + " adapter")
+}
+
+////////////////////////////////////////////////////////
+///////////////////LOCAL FUNCTIONS//////////////////////
+////////////////////////////////////////////////////////
+
+//lookupVPA returns the VPA whose targetRef is the objType/objName.
+func lookupVPA(cluster string, namespace string, objType string, objName string) (map[string]interface{}, error) {
+
+	vpas, err := listVPAs(cluster, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var match map[string]interface{}
+	for _, vpa := range vpas {
+		kind, _ := support.JSONPathValue(vpa, "{.spec.targetRef.kind}")
+		name, _ := support.JSONPathValue(vpa, "{.spec.targetRef.name}")
+		if kind != objType || name != objName {
+			continue
+		}
+		if match != nil {
+			return nil, errors.New("more than one VerticalPodAutoscaler targets " + objType + " [" + namespace + "/" + objName + "]")
+		}
+		match = vpa
+	}
+
+	if match == nil {
+		return nil, errors.New("no VerticalPodAutoscaler targets " + objType + " [" + namespace + "/" + objName + "]")
+	}
+
+	return match, nil
+
+}
+
+//listVPAs lists the VPAs of a namespace, once per run however many containers are looked up concurrently.
+func listVPAs(cluster string, namespace string) ([]map[string]interface{}, error) {
+
+	cacheMu.Lock()
+	lookup, ok := vpaCache[cluster+"/"+namespace]
+	if !ok {
+		lookup = &namespaceLookup{}
+		vpaCache[cluster+"/"+namespace] = lookup
+	}
+	cacheMu.Unlock()
+
+	lookup.once.Do(func() {
+		lookup.vpas, lookup.err = support.ListObjects(cluster, namespace, vpaKind, "")
+	})
+
+	return lookup.vpas, lookup.err
+
+}
+
+//addHeadroom validates a recommended quantity and adds the headroom to it.
+func addHeadroom(resource string, val string) (string, error) {
+
+	value, err := quantity.Value(val)
+	if err != nil {
+		return "", err
+	}
+	if value <= 0 {
+		return "", errors.New("quantity [" + val + "] must be greater than 0")
+	}
+
+	if headroom == 0 {
+		return quantity.Canonical(resource, val)
+	}
+
+	return quantity.Format(resource, value*(1+headroom/100)), nil
+
+}
+
+//validateBound checks that a setting names a VPA recommendation, or none when that is allowed.
+func validateBound(setting string, bound string, allowNone bool) error {
+
+	if _, ok := support.InSlice(bounds, bound); ok || (allowNone && bound == "none") {
+		return nil
+	}
+
+	if allowNone {
+		return errors.New("invalid " + setting + " [" + bound + "] -- use one of " + strings.Join(bounds, ", ") + " or none")
+	}
+	return errors.New("invalid " + setting + " [" + bound + "] -- use one of " + strings.Join(bounds, ", "))
+
+}
+
+//parseHeadroom parses a headroom percentage of 0 or more, with or without a trailing %.
+func parseHeadroom(val string) (float64, error) {
+
+	percent, err := strconv.ParseFloat(strings.TrimSuffix(val, "%"), 64)
+	if err != nil || percent < 0 {
+		return 0, errors.New("invalid vpa-headroom [" + val + "] -- use a percentage of 0 or more")
+	}
+
+	return percent, nil
+
+}
+
+func storeSecrets() {
+
+	secrets := make(map[string]string)
+	secrets["adapter"] = Name
+	secrets["requestBound"] = requestBound
+	secrets["limitBound"] = limitBound
+	secrets["headroom"] = strconv.FormatFloat(headroom, 'f', -1, 64)
+	support.StoreSecrets("helm-optimize-plugin", secrets)
+
+}